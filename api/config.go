@@ -1,5 +1,517 @@
 package api
 
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/units"
+)
+
+// FieldError is a problem with a single field of a config, the field is
+// named by its json path, e.g. disks[1].path.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError holds every problem found in a config.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("invalid vm config: %s", strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+type validator struct {
+	errs []*FieldError
+}
+
+func (v *validator) add(field string, format string, args ...any) {
+	v.addErr(field, fmt.Errorf(format, args...))
+}
+
+func (v *validator) addErr(field string, err error) {
+	v.errs = append(v.errs, &FieldError{Field: field, Err: err})
+}
+
+// Validate checks the config before it is sent to the vmm, so mistakes are
+// reported with the field they are in instead of a bare api error. It returns
+// a *ValidationError listing all problems.
 func (c *VmConfig) Validate() error {
+	v := &validator{}
+
+	c.validatePayload(v)
+	c.validateCpus(v)
+	c.validateMemory(v)
+	c.validateDevices(v)
+	c.validateConsoles(v)
+	c.validateNuma(v)
+
+	if len(v.errs) > 0 {
+		return &ValidationError{Errors: v.errs}
+	}
+
 	return nil
 }
+
+func (c *VmConfig) validatePayload(v *validator) {
+	if c.Payload.Kernel == nil && c.Payload.Firmware == nil {
+		v.add("payload", "kernel or firmware is required")
+	}
+
+	if c.Payload.Kernel != nil {
+		v.readable("payload.kernel", *c.Payload.Kernel)
+	}
+
+	if c.Payload.Firmware != nil {
+		v.readable("payload.firmware", *c.Payload.Firmware)
+	}
+
+	if c.Payload.Initramfs != nil {
+		v.readable("payload.initramfs", *c.Payload.Initramfs)
+	}
+}
+
+func (c *VmConfig) validateCpus(v *validator) {
+	if c.Cpus == nil {
+		return
+	}
+
+	if c.Cpus.BootVcpus < 1 {
+		v.add("cpus.boot_vcpus", "must be at least 1, got %d", c.Cpus.BootVcpus)
+	}
+
+	if c.Cpus.BootVcpus > c.Cpus.MaxVcpus {
+		v.add("cpus.max_vcpus", "must not be less than boot_vcpus %d, got %d", c.Cpus.BootVcpus, c.Cpus.MaxVcpus)
+	}
+}
+
+func (c *VmConfig) validateMemory(v *validator) {
+	if c.Memory == nil {
+		return
+	}
+
+	memory := c.Memory
+	align := pageSize(v, "memory.hugepage_size", memory.Hugepages, memory.HugepageSize)
+
+	zones := []MemoryZoneConfig{}
+	if memory.Zones != nil {
+		zones = *memory.Zones
+	}
+
+	switch {
+	case len(zones) > 0 && memory.Size != 0:
+		v.add("memory.size", "must be 0 when memory zones are used, got %d", memory.Size)
+	case len(zones) == 0 && memory.Size <= 0:
+		v.add("memory.size", "must be positive, got %d", memory.Size)
+	default:
+		aligned(v, "memory.size", memory.Size, align)
+	}
+
+	if memory.HotplugSize != nil {
+		aligned(v, "memory.hotplug_size", *memory.HotplugSize, align)
+	}
+
+	ids := map[string]bool{}
+	for i, zone := range zones {
+		field := fmt.Sprintf("memory.zones[%d]", i)
+
+		switch {
+		case zone.Id == "":
+			v.add(field+".id", "is required")
+		case ids[zone.Id]:
+			v.add(field+".id", "duplicate memory zone %q", zone.Id)
+		}
+		ids[zone.Id] = true
+
+		align := pageSize(v, field+".hugepage_size", zone.Hugepages, zone.HugepageSize)
+		if zone.Size <= 0 {
+			v.add(field+".size", "must be positive, got %d", zone.Size)
+		} else {
+			aligned(v, field+".size", zone.Size, align)
+		}
+
+		if zone.HotplugSize != nil {
+			aligned(v, field+".hotplug_size", *zone.HotplugSize, align)
+		}
+
+		if zone.File != nil {
+			v.exists(field+".file", *zone.File)
+		}
+	}
+}
+
+func (c *VmConfig) validateDevices(v *validator) {
+	ids := map[string]string{}
+	id := func(field string, id *string) {
+		if id == nil || *id == "" {
+			return
+		}
+
+		if other, ok := ids[*id]; ok {
+			v.add(field, "duplicate device id %q, already used by %s", *id, other)
+			return
+		}
+
+		ids[*id] = field
+	}
+
+	groups := map[string]bool{}
+	if c.RateLimitGroups != nil {
+		for i, group := range *c.RateLimitGroups {
+			field := fmt.Sprintf("rate_limit_groups[%d].id", i)
+
+			switch {
+			case group.Id == "":
+				v.add(field, "is required")
+			case groups[group.Id]:
+				v.add(field, "duplicate rate limit group %q", group.Id)
+			}
+			groups[group.Id] = true
+		}
+	}
+
+	if c.Disks != nil {
+		for i, disk := range *c.Disks {
+			field := fmt.Sprintf("disks[%d]", i)
+			id(field+".id", disk.Id)
+
+			if disk.VhostUser != nil && *disk.VhostUser {
+				if disk.VhostSocket == nil || *disk.VhostSocket == "" {
+					v.add(field+".vhost_socket", "is required for vhost-user disks")
+				}
+			} else {
+				v.readable(field+".path", disk.Path)
+			}
+
+			if disk.RateLimitGroup != nil && !groups[*disk.RateLimitGroup] {
+				v.add(field+".rate_limit_group", "unknown rate limit group %q", *disk.RateLimitGroup)
+			}
+		}
+	}
+
+	if c.Net != nil {
+		for i, nic := range *c.Net {
+			field := fmt.Sprintf("net[%d]", i)
+			id(field+".id", nic.Id)
+
+			if nic.Mac != nil {
+				mac(v, field+".mac", *nic.Mac)
+			}
+
+			if nic.HostMac != nil {
+				mac(v, field+".host_mac", *nic.HostMac)
+			}
+		}
+	}
+
+	if c.Fs != nil {
+		for i, fs := range *c.Fs {
+			field := fmt.Sprintf("fs[%d]", i)
+			id(field+".id", fs.Id)
+
+			if fs.Tag == "" {
+				v.add(field+".tag", "is required")
+			}
+
+			if fs.Socket == "" {
+				v.add(field+".socket", "is required")
+			}
+		}
+
+		if len(*c.Fs) > 0 && !sharedMemory(c.Memory) {
+			v.add("memory.shared", "has to be on for virtio-fs")
+		}
+	}
+
+	if c.Pmem != nil {
+		for i, pmem := range *c.Pmem {
+			field := fmt.Sprintf("pmem[%d]", i)
+			id(field+".id", pmem.Id)
+			v.exists(field+".file", pmem.File)
+		}
+	}
+
+	if c.Devices != nil {
+		for i, device := range *c.Devices {
+			field := fmt.Sprintf("devices[%d]", i)
+			id(field+".id", device.Id)
+			v.exists(field+".path", device.Path)
+		}
+	}
+
+	if c.Vdpa != nil {
+		for i, vdpa := range *c.Vdpa {
+			field := fmt.Sprintf("vdpa[%d]", i)
+			id(field+".id", vdpa.Id)
+			v.exists(field+".path", vdpa.Path)
+		}
+	}
+
+	if c.Vsock != nil {
+		id("vsock.id", c.Vsock.Id)
+
+		// cids 0 to 2 are reserved for the hypervisor and the host
+		if c.Vsock.Cid < 3 {
+			v.add("vsock.cid", "must be at least 3, got %d", c.Vsock.Cid)
+		}
+
+		if c.Vsock.Socket == "" {
+			v.add("vsock.socket", "is required")
+		}
+	}
+}
+
+func (c *VmConfig) validateConsoles(v *validator) {
+	console(v, "serial", c.Serial)
+	console(v, "console", c.Console)
+
+	if c.Serial != nil && c.Console != nil &&
+		c.Serial.Mode == ConsoleConfigModeTty && c.Console.Mode == ConsoleConfigModeTty {
+		v.add("console.mode", "serial and console can not both use %s", ConsoleConfigModeTty)
+	}
+
+	if c.Console != nil && c.Console.Mode == ConsoleConfigModeSocket {
+		v.add("console.mode", "%s is only supported by the serial", ConsoleConfigModeSocket)
+	}
+
+	if c.DebugConsole != nil {
+		hasFile := c.DebugConsole.File != nil && *c.DebugConsole.File != ""
+		if c.DebugConsole.Mode == DebugConsoleConfigModeFile && !hasFile {
+			v.add("debug_console.file", "is required in %s mode", DebugConsoleConfigModeFile)
+		}
+
+		if c.DebugConsole.Mode != DebugConsoleConfigModeFile && hasFile {
+			v.add("debug_console.file", "is only used in %s mode", DebugConsoleConfigModeFile)
+		}
+	}
+}
+
+func (c *VmConfig) validateNuma(v *validator) {
+	if c.Numa == nil {
+		return
+	}
+
+	zones := map[string]bool{}
+	if c.Memory != nil && c.Memory.Zones != nil {
+		for _, zone := range *c.Memory.Zones {
+			zones[zone.Id] = true
+		}
+	}
+
+	sections := map[string]bool{}
+	if c.SgxEpc != nil {
+		for _, section := range *c.SgxEpc {
+			sections[section.Id] = true
+		}
+	}
+
+	nodes := map[int32]bool{}
+	for _, node := range *c.Numa {
+		nodes[node.GuestNumaId] = true
+	}
+
+	seen := map[int32]bool{}
+	for i, node := range *c.Numa {
+		field := fmt.Sprintf("numa[%d]", i)
+
+		if seen[node.GuestNumaId] {
+			v.add(field+".guest_numa_id", "duplicate numa node %d", node.GuestNumaId)
+		}
+		seen[node.GuestNumaId] = true
+
+		if node.MemoryZones != nil {
+			for j, zone := range *node.MemoryZones {
+				if !zones[zone] {
+					v.add(fmt.Sprintf("%s.memory_zones[%d]", field, j), "unknown memory zone %q", zone)
+				}
+			}
+		}
+
+		if node.SgxEpcSections != nil {
+			for j, section := range *node.SgxEpcSections {
+				if !sections[section] {
+					v.add(fmt.Sprintf("%s.sgx_epc_sections[%d]", field, j), "unknown sgx epc section %q", section)
+				}
+			}
+		}
+
+		if node.Cpus != nil && c.Cpus != nil {
+			for j, cpu := range *node.Cpus {
+				if cpu < 0 || int(cpu) >= c.Cpus.MaxVcpus {
+					v.add(fmt.Sprintf("%s.cpus[%d]", field, j), "cpu %d is out of range, max_vcpus is %d", cpu, c.Cpus.MaxVcpus)
+				}
+			}
+		}
+
+		if node.Distances != nil {
+			for j, distance := range *node.Distances {
+				if !nodes[distance.Destination] {
+					v.add(fmt.Sprintf("%s.distances[%d].destination", field, j), "unknown numa node %d", distance.Destination)
+				}
+			}
+		}
+	}
+}
+
+// readable checks that path is a file that can be opened for reading.
+func (v *validator) readable(field string, path string) {
+	if path == "" {
+		v.add(field, "is required")
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		v.addErr(field, err)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		v.addErr(field, err)
+		return
+	}
+
+	if fi.IsDir() {
+		v.add(field, "%s is a directory", path)
+	}
+}
+
+func (v *validator) exists(field string, path string) {
+	if path == "" {
+		v.add(field, "is required")
+		return
+	}
+
+	_, err := os.Stat(path)
+	if err != nil {
+		v.addErr(field, err)
+	}
+}
+
+// pageSize returns the size memory has to be aligned to and checks the
+// configured hugepage size.
+func pageSize(v *validator, field string, hugepages *bool, size *int64) int64 {
+	if hugepages == nil || !*hugepages {
+		if size != nil {
+			v.add(field, "requires hugepages to be enabled")
+		}
+
+		return int64(os.Getpagesize())
+	}
+
+	if size == nil {
+		return units.DefaultHugepageSize
+	}
+
+	err := units.CheckHugepageSize(*size)
+	if err != nil {
+		v.addErr(field, err)
+		return int64(os.Getpagesize())
+	}
+
+	return *size
+}
+
+func aligned(v *validator, field string, size int64, align int64) {
+	err := units.CheckAligned(size, align)
+	if err != nil {
+		v.addErr(field, err)
+	}
+}
+
+// mac checks that s is an ethernet mac address.
+func mac(v *validator, field string, s string) {
+	hw, err := net.ParseMAC(s)
+	if err != nil {
+		v.addErr(field, err)
+		return
+	}
+
+	if len(hw) != 6 {
+		v.add(field, "%s is not a 48 bit mac address", s)
+	}
+}
+
+// console checks that the file and socket of a console match its mode.
+func console(v *validator, field string, c *ConsoleConfig) {
+	if c == nil {
+		return
+	}
+
+	hasFile := c.File != nil && *c.File != ""
+	hasSocket := c.Socket != nil && *c.Socket != ""
+
+	switch c.Mode {
+	case ConsoleConfigModeFile:
+		if !hasFile {
+			v.add(field+".file", "is required in %s mode", c.Mode)
+		}
+	case ConsoleConfigModeSocket:
+		if !hasSocket {
+			v.add(field+".socket", "is required in %s mode", c.Mode)
+		}
+	case ConsoleConfigModeOff, ConsoleConfigModeNull, ConsoleConfigModePty, ConsoleConfigModeTty:
+	default:
+		v.add(field+".mode", "unknown mode %q", c.Mode)
+	}
+
+	if hasFile && c.Mode != ConsoleConfigModeFile {
+		v.add(field+".file", "is only used in %s mode", ConsoleConfigModeFile)
+	}
+
+	if hasSocket && c.Mode != ConsoleConfigModeSocket {
+		v.add(field+".socket", "is only used in %s mode", ConsoleConfigModeSocket)
+	}
+}
+
+// sharedMemory reports whether the guest memory, or all of its zones, can be
+// shared with other processes.
+func sharedMemory(memory *MemoryConfig) bool {
+	if memory == nil {
+		return false
+	}
+
+	if memory.Shared != nil && *memory.Shared {
+		return true
+	}
+
+	if memory.Zones == nil || len(*memory.Zones) == 0 {
+		return false
+	}
+
+	for _, zone := range *memory.Zones {
+		if zone.Shared == nil || !*zone.Shared {
+			return false
+		}
+	}
+
+	return true
+}
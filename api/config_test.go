@@ -0,0 +1,246 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/units"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinux")
+	disk := filepath.Join(dir, "disk.raw")
+	for _, path := range []string{kernel, disk} {
+		err := os.WriteFile(path, nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	missing := filepath.Join(dir, "missing.raw")
+
+	tests := []struct {
+		name   string
+		config func(c *VmConfig)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			config: func(c *VmConfig) {},
+		},
+		{
+			name: "no payload",
+			config: func(c *VmConfig) {
+				c.Payload = PayloadConfig{}
+			},
+			want: []string{"payload"},
+		},
+		{
+			name: "cpus",
+			config: func(c *VmConfig) {
+				c.Cpus = &CpusConfig{BootVcpus: 0, MaxVcpus: 0}
+			},
+			want: []string{"cpus.boot_vcpus"},
+		},
+		{
+			name: "max vcpus",
+			config: func(c *VmConfig) {
+				c.Cpus = &CpusConfig{BootVcpus: 4, MaxVcpus: 2}
+			},
+			want: []string{"cpus.max_vcpus"},
+		},
+		{
+			name: "disk paths",
+			config: func(c *VmConfig) {
+				c.Disks = &[]DiskConfig{
+					{Path: disk},
+					{Path: missing},
+					{Path: dir},
+					{Path: "", VhostUser: ptr(true)},
+				}
+			},
+			want: []string{"disks[1].path", "disks[2].path", "disks[3].vhost_socket"},
+		},
+		{
+			name: "duplicate device ids",
+			config: func(c *VmConfig) {
+				c.Disks = &[]DiskConfig{{Id: ptr("dev0"), Path: disk}}
+				c.Net = &[]NetConfig{{Id: ptr("dev0")}}
+			},
+			want: []string{"net[0].id"},
+		},
+		{
+			name: "rate limit group",
+			config: func(c *VmConfig) {
+				c.Disks = &[]DiskConfig{{Path: disk, RateLimitGroup: ptr("group0")}}
+			},
+			want: []string{"disks[0].rate_limit_group"},
+		},
+		{
+			name: "memory size",
+			config: func(c *VmConfig) {
+				c.Memory = &MemoryConfig{Size: units.MiB + 1}
+			},
+			want: []string{"memory.size"},
+		},
+		{
+			name: "memory zones",
+			config: func(c *VmConfig) {
+				c.Memory = &MemoryConfig{
+					Size: units.GiB,
+					Zones: &[]MemoryZoneConfig{
+						{Id: "mem0", Size: 0},
+						{Id: "mem0", Size: units.GiB, Hugepages: ptr(true), HugepageSize: ptr[int64](3 * units.MiB)},
+						{Size: units.GiB, HugepageSize: ptr[int64](2 * units.MiB)},
+					},
+				}
+			},
+			want: []string{
+				"memory.size",
+				"memory.zones[0].size",
+				"memory.zones[1].hugepage_size",
+				"memory.zones[1].id",
+				"memory.zones[2].hugepage_size",
+				"memory.zones[2].id",
+			},
+		},
+		{
+			name: "hugepages",
+			config: func(c *VmConfig) {
+				c.Memory = &MemoryConfig{Size: 3 * units.MiB, Hugepages: ptr(true)}
+			},
+			want: []string{"memory.size"},
+		},
+		{
+			name: "numa references",
+			config: func(c *VmConfig) {
+				c.Cpus = &CpusConfig{BootVcpus: 2, MaxVcpus: 2}
+				c.Memory = &MemoryConfig{Zones: &[]MemoryZoneConfig{{Id: "mem0", Size: units.GiB}}}
+				c.SgxEpc = &[]SgxEpcConfig{{Id: "epc0", Size: 64 * units.MiB}}
+				c.Numa = &[]NumaConfig{
+					{
+						GuestNumaId:    0,
+						Cpus:           &[]int32{0, 2},
+						MemoryZones:    &[]string{"mem0", "mem1"},
+						SgxEpcSections: &[]string{"epc0", "epc1"},
+						Distances:      &[]NumaDistance{{Destination: 1, Distance: 20}, {Destination: 2, Distance: 20}},
+					},
+					{GuestNumaId: 1},
+					{GuestNumaId: 1},
+				}
+			},
+			want: []string{
+				"numa[0].cpus[1]",
+				"numa[0].distances[1].destination",
+				"numa[0].memory_zones[1]",
+				"numa[0].sgx_epc_sections[1]",
+				"numa[2].guest_numa_id",
+			},
+		},
+		{
+			name: "mac addresses",
+			config: func(c *VmConfig) {
+				c.Net = &[]NetConfig{
+					{Mac: ptr("12:34:56:78:90:01"), HostMac: ptr("12:34:56:78:90:02")},
+					{Mac: ptr("12:34:56:78:90")},
+					{HostMac: ptr("00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01")},
+				}
+			},
+			want: []string{"net[1].mac", "net[2].host_mac"},
+		},
+		{
+			name: "fs",
+			config: func(c *VmConfig) {
+				c.Fs = &[]FsConfig{{Tag: "", Socket: ""}}
+			},
+			want: []string{"fs[0].socket", "fs[0].tag", "memory.shared"},
+		},
+		{
+			name: "fs with shared memory",
+			config: func(c *VmConfig) {
+				c.Memory.Shared = ptr(true)
+				c.Fs = &[]FsConfig{{Tag: "data", Socket: filepath.Join(dir, "virtiofs.sock")}}
+			},
+		},
+		{
+			name: "console modes",
+			config: func(c *VmConfig) {
+				c.Serial = &ConsoleConfig{Mode: ConsoleConfigModeFile}
+				c.Console = &ConsoleConfig{Mode: ConsoleConfigModeSocket, File: ptr(filepath.Join(dir, "console.log"))}
+				c.DebugConsole = &DebugConsoleConfig{Mode: DebugConsoleConfigModeFile}
+			},
+			want: []string{
+				"console.file",
+				"console.mode",
+				"console.socket",
+				"debug_console.file",
+				"serial.file",
+			},
+		},
+		{
+			name: "unknown console mode",
+			config: func(c *VmConfig) {
+				c.Serial = &ConsoleConfig{Mode: "Serial", Socket: ptr(filepath.Join(dir, "serial.sock"))}
+			},
+			want: []string{"serial.mode", "serial.socket"},
+		},
+		{
+			name: "tty twice",
+			config: func(c *VmConfig) {
+				c.Serial = &ConsoleConfig{Mode: ConsoleConfigModeTty}
+				c.Console = &ConsoleConfig{Mode: ConsoleConfigModeTty}
+			},
+			want: []string{"console.mode"},
+		},
+		{
+			name: "vsock",
+			config: func(c *VmConfig) {
+				c.Vsock = &VsockConfig{Cid: 2}
+			},
+			want: []string{"vsock.cid", "vsock.socket"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &VmConfig{
+				Payload: PayloadConfig{Kernel: ptr(kernel)},
+				Cpus:    &CpusConfig{BootVcpus: 1, MaxVcpus: 1},
+				Memory:  &MemoryConfig{Size: 512 * units.MiB},
+			}
+			tt.config(config)
+
+			err := config.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() returned error: %s", err)
+				}
+				return
+			}
+
+			validation := &ValidationError{}
+			if !errors.As(err, &validation) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+
+			got := []string{}
+			for _, err := range validation.Errors {
+				got = append(got, err.Field)
+			}
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() fields = %q, want %q\n%s", got, tt.want, err)
+			}
+		})
+	}
+}
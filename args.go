@@ -0,0 +1,1242 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/units"
+)
+
+// vmmFlags take a value but configure the vmm instead of the vm, they are
+// skipped when parsing a command line.
+var vmmFlags = map[string]bool{
+	"api-socket":    true,
+	"event-monitor": true,
+	"log-file":      true,
+	"seccomp":       true,
+}
+
+// listFlags can be given several times or with several values, once per
+// device.
+var listFlags = map[string]bool{
+	"memory-zone":      true,
+	"disk":             true,
+	"net":              true,
+	"fs":               true,
+	"pmem":             true,
+	"device":           true,
+	"vdpa":             true,
+	"numa":             true,
+	"sgx-epc":          true,
+	"pci-segment":      true,
+	"rate-limit-group": true,
+}
+
+// ConfigArgs renders the config as cloud-hypervisor command line arguments,
+// e.g. --kernel, --cpus, --memory and --disk, so the vmm boots the vm without
+// it being created through the api.
+func ConfigArgs(c api.VmConfig) []string {
+	args := []string{}
+	flag := func(name string, o argOptions) {
+		if len(o) > 0 {
+			args = append(args, "--"+name, o.String())
+		}
+	}
+
+	if c.Payload.Kernel != nil {
+		args = append(args, "--kernel", *c.Payload.Kernel)
+	}
+
+	if c.Payload.Firmware != nil {
+		args = append(args, "--firmware", *c.Payload.Firmware)
+	}
+
+	if c.Payload.Initramfs != nil {
+		args = append(args, "--initramfs", *c.Payload.Initramfs)
+	}
+
+	if c.Payload.Cmdline != nil {
+		args = append(args, "--cmdline", *c.Payload.Cmdline)
+	}
+
+	if c.Cpus != nil {
+		flag("cpus", cpusArg(c.Cpus))
+	}
+
+	if c.Memory != nil {
+		flag("memory", memoryArg(c.Memory))
+
+		for _, zone := range deref(c.Memory.Zones) {
+			flag("memory-zone", memoryZoneArg(zone))
+		}
+	}
+
+	for _, group := range deref(c.RateLimitGroups) {
+		o := argOptions{}
+		o.add("id", group.Id)
+		o.rateLimiter(&group.RateLimiterConfig)
+		flag("rate-limit-group", o)
+	}
+
+	for _, disk := range deref(c.Disks) {
+		flag("disk", diskArg(disk))
+	}
+
+	for _, net := range deref(c.Net) {
+		flag("net", netArg(net))
+	}
+
+	if c.Rng != nil {
+		o := argOptions{}
+		o.add("src", c.Rng.Src)
+		o.boolean("iommu", c.Rng.Iommu)
+		flag("rng", o)
+	}
+
+	if c.Balloon != nil {
+		o := argOptions{}
+		o.size("size", &c.Balloon.Size)
+		o.boolean("deflate_on_oom", c.Balloon.DeflateOnOom)
+		o.boolean("free_page_reporting", c.Balloon.FreePageReporting)
+		flag("balloon", o)
+	}
+
+	for _, fs := range deref(c.Fs) {
+		o := argOptions{}
+		o.add("tag", fs.Tag)
+		o.add("socket", fs.Socket)
+		addInt(&o, "num_queues", &fs.NumQueues)
+		addInt(&o, "queue_size", &fs.QueueSize)
+		o.str("id", fs.Id)
+		addInt(&o, "pci_segment", fs.PciSegment)
+		flag("fs", o)
+	}
+
+	for _, pmem := range deref(c.Pmem) {
+		o := argOptions{}
+		o.add("file", pmem.File)
+		o.size("size", pmem.Size)
+		o.boolean("iommu", pmem.Iommu)
+		o.boolean("discard_writes", pmem.DiscardWrites)
+		o.str("id", pmem.Id)
+		addInt(&o, "pci_segment", pmem.PciSegment)
+		flag("pmem", o)
+	}
+
+	if c.Serial != nil {
+		flag("serial", consoleArg(c.Serial))
+	}
+
+	if c.Console != nil {
+		flag("console", consoleArg(c.Console))
+	}
+
+	if c.DebugConsole != nil {
+		o := argOptions{}
+		if c.DebugConsole.Mode == api.DebugConsoleConfigModeFile && c.DebugConsole.File != nil {
+			o.add("file", *c.DebugConsole.File)
+		} else {
+			o = append(o, strings.ToLower(string(c.DebugConsole.Mode)))
+		}
+		addInt(&o, "iobase", c.DebugConsole.Iobase)
+		flag("debug-console", o)
+	}
+
+	for _, device := range deref(c.Devices) {
+		o := argOptions{}
+		o.add("path", device.Path)
+		o.boolean("iommu", device.Iommu)
+		o.str("id", device.Id)
+		addInt(&o, "pci_segment", device.PciSegment)
+		addInt(&o, "x_nv_gpudirect_clique", device.XNvGpudirectClique)
+		flag("device", o)
+	}
+
+	for _, vdpa := range deref(c.Vdpa) {
+		o := argOptions{}
+		o.add("path", vdpa.Path)
+		addInt(&o, "num_queues", &vdpa.NumQueues)
+		o.boolean("iommu", vdpa.Iommu)
+		o.str("id", vdpa.Id)
+		addInt(&o, "pci_segment", vdpa.PciSegment)
+		flag("vdpa", o)
+	}
+
+	if c.Vsock != nil {
+		o := argOptions{}
+		addInt(&o, "cid", &c.Vsock.Cid)
+		o.add("socket", c.Vsock.Socket)
+		o.boolean("iommu", c.Vsock.Iommu)
+		o.str("id", c.Vsock.Id)
+		addInt(&o, "pci_segment", c.Vsock.PciSegment)
+		flag("vsock", o)
+	}
+
+	if c.Pvpanic != nil && *c.Pvpanic {
+		args = append(args, "--pvpanic")
+	}
+
+	if c.Watchdog != nil && *c.Watchdog {
+		args = append(args, "--watchdog")
+	}
+
+	for _, section := range deref(c.SgxEpc) {
+		o := argOptions{}
+		o.add("id", section.Id)
+		o.size("size", &section.Size)
+		o.boolean("prefault", section.Prefault)
+		flag("sgx-epc", o)
+	}
+
+	for _, node := range deref(c.Numa) {
+		flag("numa", numaArg(node))
+	}
+
+	for _, segment := range deref(c.PciSegments) {
+		o := argOptions{}
+		addInt(&o, "pci_segment", &segment.PciSegment)
+		addInt(&o, "mmio32_aperture_weight", segment.Mmio32ApertureWeight)
+		addInt(&o, "mmio64_aperture_weight", segment.Mmio64ApertureWeight)
+		flag("pci-segment", o)
+	}
+
+	if c.Platform != nil {
+		flag("platform", platformArg(c.Platform))
+	}
+
+	if c.Tpm != nil {
+		o := argOptions{}
+		o.add("socket", c.Tpm.Socket)
+		flag("tpm", o)
+	}
+
+	return args
+}
+
+func cpusArg(cpus *api.CpusConfig) argOptions {
+	o := argOptions{}
+	addInt(&o, "boot", &cpus.BootVcpus)
+	addInt(&o, "max", &cpus.MaxVcpus)
+	o.boolean("kvm_hyperv", cpus.KvmHyperv)
+	addInt(&o, "max_phys_bits", cpus.MaxPhysBits)
+
+	if t := cpus.Topology; t != nil {
+		o.add("topology", fmt.Sprintf("%d:%d:%d:%d", orZero(t.ThreadsPerCore), orZero(t.CoresPerDie), orZero(t.DiesPerPackage), orZero(t.Packages)))
+	}
+
+	if cpus.Affinity != nil {
+		affinity := []string{}
+		for _, a := range *cpus.Affinity {
+			affinity = append(affinity, fmt.Sprintf("%d@%s", a.Vcpu, formatIntList(a.HostCpus)))
+		}
+		o.add("affinity", "["+strings.Join(affinity, ",")+"]")
+	}
+
+	if cpus.Features != nil && cpus.Features.Amx != nil && *cpus.Features.Amx {
+		o.add("features", "amx")
+	}
+
+	return o
+}
+
+func memoryArg(memory *api.MemoryConfig) argOptions {
+	o := argOptions{}
+	o.size("size", &memory.Size)
+	o.boolean("mergeable", memory.Mergeable)
+	o.boolean("shared", memory.Shared)
+	o.boolean("hugepages", memory.Hugepages)
+	o.size("hugepage_size", memory.HugepageSize)
+	o.str("hotplug_method", memory.HotplugMethod)
+	o.size("hotplug_size", memory.HotplugSize)
+	o.size("hotplugged_size", memory.HotpluggedSize)
+	o.boolean("prefault", memory.Prefault)
+	o.boolean("thp", memory.Thp)
+	return o
+}
+
+func memoryZoneArg(zone api.MemoryZoneConfig) argOptions {
+	o := argOptions{}
+	o.add("id", zone.Id)
+	o.size("size", &zone.Size)
+	o.str("file", zone.File)
+	o.boolean("shared", zone.Shared)
+	o.boolean("hugepages", zone.Hugepages)
+	o.size("hugepage_size", zone.HugepageSize)
+	addInt(&o, "host_numa_node", zone.HostNumaNode)
+	o.size("hotplug_size", zone.HotplugSize)
+	o.size("hotplugged_size", zone.HotpluggedSize)
+	o.boolean("prefault", zone.Prefault)
+	return o
+}
+
+func diskArg(disk api.DiskConfig) argOptions {
+	o := argOptions{}
+	if disk.Path != "" {
+		o.add("path", disk.Path)
+	}
+	o.boolean("readonly", disk.Readonly)
+	o.boolean("direct", disk.Direct)
+	o.boolean("iommu", disk.Iommu)
+	addInt(&o, "num_queues", disk.NumQueues)
+	addInt(&o, "queue_size", disk.QueueSize)
+	o.boolean("vhost_user", disk.VhostUser)
+	o.str("socket", disk.VhostSocket)
+	o.str("id", disk.Id)
+	addInt(&o, "pci_segment", disk.PciSegment)
+	o.str("serial", disk.Serial)
+	o.str("rate_limit_group", disk.RateLimitGroup)
+	o.rateLimiter(disk.RateLimiterConfig)
+
+	if disk.QueueAffinity != nil {
+		affinity := []string{}
+		for _, a := range *disk.QueueAffinity {
+			affinity = append(affinity, fmt.Sprintf("%d@%s", a.QueueIndex, formatIntList(a.HostCpus)))
+		}
+		o.add("queue_affinity", "["+strings.Join(affinity, ",")+"]")
+	}
+
+	return o
+}
+
+func netArg(net api.NetConfig) argOptions {
+	o := argOptions{}
+	o.str("tap", net.Tap)
+	o.str("ip", net.Ip)
+	o.str("mask", net.Mask)
+	o.str("mac", net.Mac)
+	o.str("host_mac", net.HostMac)
+	addInt(&o, "mtu", net.Mtu)
+	o.boolean("iommu", net.Iommu)
+	addInt(&o, "num_queues", net.NumQueues)
+	addInt(&o, "queue_size", net.QueueSize)
+	o.str("id", net.Id)
+	o.boolean("vhost_user", net.VhostUser)
+	o.str("socket", net.VhostSocket)
+	o.str("vhost_mode", net.VhostMode)
+	addInt(&o, "pci_segment", net.PciSegment)
+	o.rateLimiter(net.RateLimiterConfig)
+	return o
+}
+
+func consoleArg(console *api.ConsoleConfig) argOptions {
+	o := argOptions{}
+	switch {
+	case console.Mode == api.ConsoleConfigModeFile && console.File != nil:
+		o.add("file", *console.File)
+	case console.Mode == api.ConsoleConfigModeSocket && console.Socket != nil:
+		o.add("socket", *console.Socket)
+	default:
+		o = append(o, strings.ToLower(string(console.Mode)))
+	}
+
+	o.boolean("iommu", console.Iommu)
+	return o
+}
+
+func numaArg(node api.NumaConfig) argOptions {
+	o := argOptions{}
+	addInt(&o, "guest_numa_id", &node.GuestNumaId)
+
+	if node.Cpus != nil {
+		o.add("cpus", formatIntList(*node.Cpus))
+	}
+
+	if node.Distances != nil {
+		distances := []string{}
+		for _, d := range *node.Distances {
+			distances = append(distances, fmt.Sprintf("%d@%d", d.Destination, d.Distance))
+		}
+		o.add("distances", "["+strings.Join(distances, ",")+"]")
+	}
+
+	o.list("memory_zones", node.MemoryZones)
+	o.list("sgx_epc_sections", node.SgxEpcSections)
+
+	if node.PciSegments != nil {
+		o.add("pci_segments", formatIntList(*node.PciSegments))
+	}
+
+	return o
+}
+
+func platformArg(platform *api.PlatformConfig) argOptions {
+	o := argOptions{}
+	addInt(&o, "num_pci_segments", platform.NumPciSegments)
+
+	if platform.IommuSegments != nil {
+		o.add("iommu_segments", formatIntList(*platform.IommuSegments))
+	}
+
+	o.str("serial_number", platform.SerialNumber)
+	o.str("uuid", platform.Uuid)
+	o.list("oem_strings", platform.OemStrings)
+	o.boolean("tdx", platform.Tdx)
+	return o
+}
+
+// CommandLine returns the cloud-hypervisor command line that boots the vm of
+// the machine without the sdk, for debugging or to reproduce it by hand.
+func (m *MachineImpl) CommandLine() string {
+	args := append([]string{m.binary}, ConfigArgs(m.Config())...)
+	args = append(args, m.args...)
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// WithConfigArgs passes the config to cloud-hypervisor as command line
+// arguments instead of creating the vm through the api, the vmm boots it
+// right away. The api socket is still used to control the vm.
+func WithConfigArgs() Option {
+	return func(m *MachineImpl) error {
+		m.configArgs = true
+		return nil
+	}
+}
+
+// startFromArgs starts a vmm that boots the vm from its command line. The
+// shares are started first as the vmm connects to them while booting.
+func (m *MachineImpl) startFromArgs() error {
+	if m.snapshot != "" {
+		return fmt.Errorf("could not start machine: a snapshot can not be restored when the config is passed as arguments")
+	}
+
+	err := m.startShares()
+	if err != nil {
+		m.logger.Println(err)
+		m.eventReader.Close()
+		m.eventWriter.Close()
+		m.exit(err)
+
+		return err
+	}
+
+	err = m.launchVMM()
+	if err != nil {
+		return err
+	}
+
+	info, err := m.Info(m.context)
+	if err != nil {
+		m.logger.Println(err)
+		m.exit(err)
+
+		return err
+	}
+
+	m.setState(vmStates[info.State], nil)
+
+	return nil
+}
+
+// ParseConfigArgs parses a cloud-hypervisor command line into a config, it is
+// the reverse of ConfigArgs. Arguments that configure the vmm rather than the
+// vm, like --api-socket and -v, are skipped.
+func ParseConfigArgs(args []string) (api.VmConfig, error) {
+	c := api.VmConfig{}
+	errs := []error{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			errs = append(errs, fmt.Errorf("unexpected argument %q", arg))
+			continue
+		}
+
+		if strings.Trim(arg, "v") == "-" {
+			continue
+		}
+
+		name, inline, hasInline := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		// collect the values of the flag, list flags take several
+		values := []string{}
+		if hasInline {
+			values = append(values, inline)
+		}
+
+		switch name {
+		case "pvpanic", "watchdog":
+			enabled := true
+			if name == "pvpanic" {
+				c.Pvpanic = &enabled
+			} else {
+				c.Watchdog = &enabled
+			}
+			continue
+		}
+
+		for !hasInline && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			values = append(values, args[i])
+
+			if !listFlags[name] {
+				break
+			}
+		}
+
+		if len(values) == 0 {
+			errs = append(errs, fmt.Errorf("--%s: missing value", name))
+			continue
+		}
+
+		if vmmFlags[name] {
+			continue
+		}
+
+		for _, value := range values {
+			err := parseConfigArg(&c, name, value)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return api.VmConfig{}, fmt.Errorf("could not parse arguments: %w", errors.Join(errs...))
+	}
+
+	return c, nil
+}
+
+func parseConfigArg(c *api.VmConfig, name string, value string) error {
+	switch name {
+	case "kernel":
+		c.Payload.Kernel = &value
+		return nil
+	case "firmware":
+		c.Payload.Firmware = &value
+		return nil
+	case "initramfs":
+		c.Payload.Initramfs = &value
+		return nil
+	case "cmdline":
+		c.Payload.Cmdline = &value
+		return nil
+	}
+
+	p, err := newArgParser(name, value)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "cpus":
+		c.Cpus = parseCpus(p)
+	case "memory":
+		c.Memory = parseMemory(p, c.Memory)
+	case "memory-zone":
+		zone := api.MemoryZoneConfig{
+			Id:             orZero(p.str("id")),
+			Size:           orZero(p.size("size")),
+			File:           p.str("file"),
+			Shared:         p.boolean("shared"),
+			Hugepages:      p.boolean("hugepages"),
+			HugepageSize:   p.size("hugepage_size"),
+			HostNumaNode:   parseInt[int32](p, "host_numa_node"),
+			HotplugSize:    p.size("hotplug_size"),
+			HotpluggedSize: p.size("hotplugged_size"),
+			Prefault:       p.boolean("prefault"),
+		}
+
+		if c.Memory == nil {
+			c.Memory = &api.MemoryConfig{}
+		}
+		c.Memory.Zones = appendDevice(c.Memory.Zones, zone)
+	case "rate-limit-group":
+		group := api.RateLimitGroupConfig{
+			Id: orZero(p.str("id")),
+		}
+		if limiter := p.rateLimiter(); limiter != nil {
+			group.RateLimiterConfig = *limiter
+		}
+		c.RateLimitGroups = appendDevice(c.RateLimitGroups, group)
+	case "disk":
+		c.Disks = appendDevice(c.Disks, parseDisk(p))
+	case "net":
+		c.Net = appendDevice(c.Net, parseNet(p))
+	case "rng":
+		c.Rng = &api.RngConfig{
+			Src:   orZero(p.str("src")),
+			Iommu: p.boolean("iommu"),
+		}
+	case "balloon":
+		c.Balloon = &api.BalloonConfig{
+			Size:              orZero(p.size("size")),
+			DeflateOnOom:      p.boolean("deflate_on_oom"),
+			FreePageReporting: p.boolean("free_page_reporting"),
+		}
+	case "fs":
+		c.Fs = appendDevice(c.Fs, api.FsConfig{
+			Tag:        orZero(p.str("tag")),
+			Socket:     orZero(p.str("socket")),
+			NumQueues:  orZero(parseInt[int](p, "num_queues")),
+			QueueSize:  orZero(parseInt[int](p, "queue_size")),
+			Id:         p.str("id"),
+			PciSegment: parseInt[int16](p, "pci_segment"),
+		})
+	case "pmem":
+		c.Pmem = appendDevice(c.Pmem, api.PmemConfig{
+			File:          orZero(p.str("file")),
+			Size:          p.size("size"),
+			Iommu:         p.boolean("iommu"),
+			DiscardWrites: p.boolean("discard_writes"),
+			Id:            p.str("id"),
+			PciSegment:    parseInt[int16](p, "pci_segment"),
+		})
+	case "serial":
+		c.Serial = parseConsole(p)
+	case "console":
+		c.Console = parseConsole(p)
+	case "debug-console":
+		c.DebugConsole = &api.DebugConsoleConfig{
+			Mode:   api.DebugConsoleConfigMode(parseMode(p)),
+			File:   p.str("file"),
+			Iobase: parseInt[int](p, "iobase"),
+		}
+	case "device":
+		c.Devices = appendDevice(c.Devices, api.DeviceConfig{
+			Path:               orZero(p.str("path")),
+			Iommu:              p.boolean("iommu"),
+			Id:                 p.str("id"),
+			PciSegment:         parseInt[int16](p, "pci_segment"),
+			XNvGpudirectClique: parseInt[int8](p, "x_nv_gpudirect_clique"),
+		})
+	case "vdpa":
+		c.Vdpa = appendDevice(c.Vdpa, api.VdpaConfig{
+			Path:       orZero(p.str("path")),
+			NumQueues:  orZero(parseInt[int](p, "num_queues")),
+			Iommu:      p.boolean("iommu"),
+			Id:         p.str("id"),
+			PciSegment: parseInt[int16](p, "pci_segment"),
+		})
+	case "vsock":
+		c.Vsock = &api.VsockConfig{
+			Cid:        orZero(parseInt[int64](p, "cid")),
+			Socket:     orZero(p.str("socket")),
+			Iommu:      p.boolean("iommu"),
+			Id:         p.str("id"),
+			PciSegment: parseInt[int16](p, "pci_segment"),
+		}
+	case "sgx-epc":
+		c.SgxEpc = appendDevice(c.SgxEpc, api.SgxEpcConfig{
+			Id:       orZero(p.str("id")),
+			Size:     orZero(p.size("size")),
+			Prefault: p.boolean("prefault"),
+		})
+	case "numa":
+		c.Numa = appendDevice(c.Numa, parseNuma(p))
+	case "pci-segment":
+		c.PciSegments = appendDevice(c.PciSegments, api.PciSegmentConfig{
+			PciSegment:           orZero(parseInt[int16](p, "pci_segment")),
+			Mmio32ApertureWeight: parseInt[int32](p, "mmio32_aperture_weight"),
+			Mmio64ApertureWeight: parseInt[int32](p, "mmio64_aperture_weight"),
+		})
+	case "platform":
+		c.Platform = &api.PlatformConfig{
+			NumPciSegments: parseInt[int16](p, "num_pci_segments"),
+			IommuSegments:  parseIntList[int16](p, "iommu_segments"),
+			SerialNumber:   p.str("serial_number"),
+			Uuid:           p.str("uuid"),
+			OemStrings:     p.list("oem_strings"),
+			Tdx:            p.boolean("tdx"),
+		}
+	case "tpm":
+		c.Tpm = &api.TpmConfig{
+			Socket: orZero(p.str("socket")),
+		}
+	default:
+		return fmt.Errorf("--%s: unsupported argument", name)
+	}
+
+	return p.err()
+}
+
+func parseCpus(p *argParser) *api.CpusConfig {
+	cpus := &api.CpusConfig{
+		BootVcpus:   orZero(parseInt[int](p, "boot")),
+		KvmHyperv:   p.boolean("kvm_hyperv"),
+		MaxPhysBits: parseInt[int](p, "max_phys_bits"),
+	}
+
+	// cloud-hypervisor defaults max to boot
+	cpus.MaxVcpus = cpus.BootVcpus
+	if max := parseInt[int](p, "max"); max != nil {
+		cpus.MaxVcpus = *max
+	}
+
+	if topology := p.str("topology"); topology != nil {
+		parts := strings.Split(*topology, ":")
+		values := make([]int, len(parts))
+		for i, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil || len(parts) != 4 {
+				p.fail("topology", fmt.Errorf("invalid topology %q, expected threads:cores:dies:packages", *topology))
+				break
+			}
+			values[i] = n
+		}
+
+		if len(values) == 4 {
+			cpus.Topology = &api.CpuTopology{
+				ThreadsPerCore: &values[0],
+				CoresPerDie:    &values[1],
+				DiesPerPackage: &values[2],
+				Packages:       &values[3],
+			}
+		}
+	}
+
+	if affinity := p.str("affinity"); affinity != nil {
+		list := []api.CpuAffinity{}
+		for _, item := range splitList(*affinity) {
+			index, hostCpus, err := parseAffinity(item)
+			if err != nil {
+				p.fail("affinity", err)
+				continue
+			}
+			list = append(list, api.CpuAffinity{Vcpu: index, HostCpus: hostCpus})
+		}
+		cpus.Affinity = &list
+	}
+
+	if features := p.str("features"); features != nil {
+		for _, feature := range strings.Split(*features, ":") {
+			if feature != "amx" {
+				p.fail("features", fmt.Errorf("unknown cpu feature %q", feature))
+				continue
+			}
+
+			amx := true
+			cpus.Features = &api.CpuFeatures{Amx: &amx}
+		}
+	}
+
+	return cpus
+}
+
+func parseMemory(p *argParser, existing *api.MemoryConfig) *api.MemoryConfig {
+	memory := &api.MemoryConfig{
+		Size:           orZero(p.size("size")),
+		Mergeable:      p.boolean("mergeable"),
+		Shared:         p.boolean("shared"),
+		Hugepages:      p.boolean("hugepages"),
+		HugepageSize:   p.size("hugepage_size"),
+		HotplugMethod:  p.str("hotplug_method"),
+		HotplugSize:    p.size("hotplug_size"),
+		HotpluggedSize: p.size("hotplugged_size"),
+		Prefault:       p.boolean("prefault"),
+		Thp:            p.boolean("thp"),
+	}
+
+	// zones may have been given before the memory
+	if existing != nil {
+		memory.Zones = existing.Zones
+	}
+
+	return memory
+}
+
+func parseDisk(p *argParser) api.DiskConfig {
+	disk := api.DiskConfig{
+		Path:              orZero(p.str("path")),
+		Readonly:          p.boolean("readonly"),
+		Direct:            p.boolean("direct"),
+		Iommu:             p.boolean("iommu"),
+		NumQueues:         parseInt[int](p, "num_queues"),
+		QueueSize:         parseInt[int](p, "queue_size"),
+		VhostUser:         p.boolean("vhost_user"),
+		VhostSocket:       p.str("socket"),
+		Id:                p.str("id"),
+		PciSegment:        parseInt[int16](p, "pci_segment"),
+		Serial:            p.str("serial"),
+		RateLimitGroup:    p.str("rate_limit_group"),
+		RateLimiterConfig: p.rateLimiter(),
+	}
+
+	if affinity := p.str("queue_affinity"); affinity != nil {
+		list := []api.VirtQueueAffinity{}
+		for _, item := range splitList(*affinity) {
+			index, hostCpus, err := parseAffinity(item)
+			if err != nil {
+				p.fail("queue_affinity", err)
+				continue
+			}
+			list = append(list, api.VirtQueueAffinity{QueueIndex: index, HostCpus: hostCpus})
+		}
+		disk.QueueAffinity = &list
+	}
+
+	return disk
+}
+
+func parseNet(p *argParser) api.NetConfig {
+	return api.NetConfig{
+		Tap:               p.str("tap"),
+		Ip:                p.str("ip"),
+		Mask:              p.str("mask"),
+		Mac:               p.str("mac"),
+		HostMac:           p.str("host_mac"),
+		Mtu:               parseInt[int](p, "mtu"),
+		Iommu:             p.boolean("iommu"),
+		NumQueues:         parseInt[int](p, "num_queues"),
+		QueueSize:         parseInt[int](p, "queue_size"),
+		Id:                p.str("id"),
+		VhostUser:         p.boolean("vhost_user"),
+		VhostSocket:       p.str("socket"),
+		VhostMode:         p.str("vhost_mode"),
+		PciSegment:        parseInt[int16](p, "pci_segment"),
+		RateLimiterConfig: p.rateLimiter(),
+	}
+}
+
+func parseConsole(p *argParser) *api.ConsoleConfig {
+	return &api.ConsoleConfig{
+		Mode:   api.ConsoleConfigMode(parseMode(p)),
+		File:   p.str("file"),
+		Socket: p.str("socket"),
+		Iommu:  p.boolean("iommu"),
+	}
+}
+
+// parseMode returns the mode of a console, given either as a bare word like
+// pty or by its file or socket.
+func parseMode(p *argParser) string {
+	for _, mode := range []string{"off", "null", "pty", "tty"} {
+		if p.flag(mode) {
+			return strings.ToUpper(mode[:1]) + mode[1:]
+		}
+	}
+
+	switch {
+	case p.has("file"):
+		return string(api.ConsoleConfigModeFile)
+	case p.has("socket"):
+		return string(api.ConsoleConfigModeSocket)
+	}
+
+	p.fail("mode", fmt.Errorf("missing mode"))
+	return ""
+}
+
+func parseNuma(p *argParser) api.NumaConfig {
+	node := api.NumaConfig{
+		GuestNumaId:    orZero(parseInt[int32](p, "guest_numa_id")),
+		Cpus:           parseIntList[int32](p, "cpus"),
+		MemoryZones:    p.list("memory_zones"),
+		SgxEpcSections: p.list("sgx_epc_sections"),
+		PciSegments:    parseIntList[int32](p, "pci_segments"),
+	}
+
+	if distances := p.str("distances"); distances != nil {
+		list := []api.NumaDistance{}
+		for _, item := range splitList(*distances) {
+			destination, distance, ok := strings.Cut(item, "@")
+			d, err1 := strconv.ParseInt(destination, 10, 32)
+			v, err2 := strconv.ParseInt(distance, 10, 32)
+			if !ok || err1 != nil || err2 != nil {
+				p.fail("distances", fmt.Errorf("invalid distance %q, expected destination@distance", item))
+				continue
+			}
+			list = append(list, api.NumaDistance{Destination: int32(d), Distance: int32(v)})
+		}
+		node.Distances = &list
+	}
+
+	return node
+}
+
+// parseAffinity parses an affinity like 0@[1,2-3].
+func parseAffinity(s string) (int, []int, error) {
+	index, list, ok := strings.Cut(s, "@")
+	i, err := strconv.Atoi(index)
+	if !ok || err != nil {
+		return 0, nil, fmt.Errorf("invalid affinity %q, expected index@[cpus]", s)
+	}
+
+	cpus, err := parseRanges[int](list)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return i, cpus, nil
+}
+
+// argOptions are the comma separated key=value options of a flag.
+type argOptions []string
+
+func (o *argOptions) add(key string, value string) {
+	*o = append(*o, key+"="+value)
+}
+
+func (o *argOptions) str(key string, value *string) {
+	if value != nil {
+		o.add(key, *value)
+	}
+}
+
+func (o *argOptions) boolean(key string, value *bool) {
+	if value == nil {
+		return
+	}
+
+	if *value {
+		o.add(key, "on")
+	} else {
+		o.add(key, "off")
+	}
+}
+
+func (o *argOptions) size(key string, value *int64) {
+	if value != nil {
+		o.add(key, formatArgSize(*value))
+	}
+}
+
+func (o *argOptions) list(key string, values *[]string) {
+	if values != nil {
+		o.add(key, "["+strings.Join(*values, ",")+"]")
+	}
+}
+
+func (o *argOptions) rateLimiter(limiter *api.RateLimiterConfig) {
+	if limiter == nil {
+		return
+	}
+
+	o.tokenBucket("bw", limiter.Bandwidth)
+	o.tokenBucket("ops", limiter.Ops)
+}
+
+func (o *argOptions) tokenBucket(prefix string, bucket *api.TokenBucket) {
+	if bucket == nil {
+		return
+	}
+
+	addInt(o, prefix+"_size", &bucket.Size)
+	addInt(o, prefix+"_one_time_burst", bucket.OneTimeBurst)
+	addInt(o, prefix+"_refill_time", &bucket.RefillTime)
+}
+
+func (o argOptions) String() string {
+	return strings.Join(o, ",")
+}
+
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+func addInt[T integer](o *argOptions, key string, value *T) {
+	if value != nil {
+		o.add(key, strconv.FormatInt(int64(*value), 10))
+	}
+}
+
+// formatArgSize formats a size with the K, M and G suffixes cloud-hypervisor
+// understands.
+func formatArgSize(size int64) string {
+	switch {
+	case size != 0 && size%units.GiB == 0:
+		return fmt.Sprintf("%dG", size/units.GiB)
+	case size != 0 && size%units.MiB == 0:
+		return fmt.Sprintf("%dM", size/units.MiB)
+	case size != 0 && size%units.KiB == 0:
+		return fmt.Sprintf("%dK", size/units.KiB)
+	}
+
+	return strconv.FormatInt(size, 10)
+}
+
+func formatIntList[T integer](values []T) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.FormatInt(int64(v), 10)
+	}
+
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// argParser reads the key=value options of a flag and records every problem.
+type argParser struct {
+	name    string
+	options map[string]string
+	used    map[string]bool
+	errs    []error
+}
+
+func newArgParser(name string, value string) (*argParser, error) {
+	p := &argParser{
+		name:    name,
+		options: map[string]string{},
+		used:    map[string]bool{},
+	}
+
+	for _, option := range splitOptions(value) {
+		key, value, _ := strings.Cut(option, "=")
+		if _, ok := p.options[key]; ok {
+			return nil, fmt.Errorf("--%s: duplicate option %s", name, key)
+		}
+
+		p.options[key] = value
+	}
+
+	return p, nil
+}
+
+func (p *argParser) fail(key string, err error) {
+	p.errs = append(p.errs, fmt.Errorf("--%s: %s: %w", p.name, key, err))
+}
+
+func (p *argParser) has(key string) bool {
+	_, ok := p.options[key]
+	return ok
+}
+
+// flag reports whether a bare word like pty was given.
+func (p *argParser) flag(key string) bool {
+	value, ok := p.options[key]
+	if ok && value == "" {
+		p.used[key] = true
+		return true
+	}
+
+	return false
+}
+
+func (p *argParser) str(key string) *string {
+	value, ok := p.options[key]
+	if !ok {
+		return nil
+	}
+
+	p.used[key] = true
+	return &value
+}
+
+func (p *argParser) boolean(key string) *bool {
+	value := p.str(key)
+	if value == nil {
+		return nil
+	}
+
+	var b bool
+	switch *value {
+	case "on", "true":
+		b = true
+	case "off", "false":
+		b = false
+	default:
+		p.fail(key, fmt.Errorf("invalid value %q, expected on or off", *value))
+		return nil
+	}
+
+	return &b
+}
+
+func (p *argParser) size(key string) *int64 {
+	value := p.str(key)
+	if value == nil {
+		return nil
+	}
+
+	size, err := units.ParseSize(*value)
+	if err != nil {
+		p.fail(key, err)
+		return nil
+	}
+
+	return &size
+}
+
+func (p *argParser) list(key string) *[]string {
+	value := p.str(key)
+	if value == nil {
+		return nil
+	}
+
+	list := splitList(*value)
+	return &list
+}
+
+func (p *argParser) rateLimiter() *api.RateLimiterConfig {
+	bucket := func(prefix string) *api.TokenBucket {
+		size := parseInt[int64](p, prefix+"_size")
+		burst := parseInt[int64](p, prefix+"_one_time_burst")
+		refill := parseInt[int64](p, prefix+"_refill_time")
+		if size == nil && burst == nil && refill == nil {
+			return nil
+		}
+
+		return &api.TokenBucket{
+			Size:         orZero(size),
+			OneTimeBurst: burst,
+			RefillTime:   orZero(refill),
+		}
+	}
+
+	limiter := &api.RateLimiterConfig{
+		Bandwidth: bucket("bw"),
+		Ops:       bucket("ops"),
+	}
+
+	if limiter.Bandwidth == nil && limiter.Ops == nil {
+		return nil
+	}
+
+	return limiter
+}
+
+// err reports the problems found and the options that were not understood.
+func (p *argParser) err() error {
+	unknown := []string{}
+	for key := range p.options {
+		if !p.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		p.errs = append(p.errs, fmt.Errorf("--%s: unknown option %s", p.name, key))
+	}
+
+	return errors.Join(p.errs...)
+}
+
+func parseInt[T integer](p *argParser, key string) *T {
+	value := p.str(key)
+	if value == nil {
+		return nil
+	}
+
+	var zero T
+	n, err := strconv.ParseInt(*value, 10, bitSize(zero))
+	if err != nil {
+		p.fail(key, err)
+		return nil
+	}
+
+	v := T(n)
+	return &v
+}
+
+func parseIntList[T integer](p *argParser, key string) *[]T {
+	value := p.str(key)
+	if value == nil {
+		return nil
+	}
+
+	list, err := parseRanges[T](*value)
+	if err != nil {
+		p.fail(key, err)
+		return nil
+	}
+
+	return &list
+}
+
+// parseRanges parses a list like [0,2-4] into 0, 2, 3 and 4.
+func parseRanges[T integer](s string) ([]T, error) {
+	var zero T
+	list := []T{}
+
+	for _, item := range splitList(s) {
+		from, to, isRange := strings.Cut(item, "-")
+		if !isRange {
+			to = from
+		}
+
+		start, err1 := strconv.ParseInt(from, 10, bitSize(zero))
+		end, err2 := strconv.ParseInt(to, 10, bitSize(zero))
+		if err1 != nil || err2 != nil || end < start {
+			return nil, fmt.Errorf("invalid list item %q", item)
+		}
+
+		for i := start; i <= end; i++ {
+			list = append(list, T(i))
+		}
+	}
+
+	return list, nil
+}
+
+func bitSize[T integer](v T) int {
+	switch any(v).(type) {
+	case int8:
+		return 8
+	case int16:
+		return 16
+	case int32:
+		return 32
+	}
+
+	return 64
+}
+
+// splitOptions splits the options of a flag at the commas that are not inside
+// brackets.
+func splitOptions(s string) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// splitList splits a list like [a,b] into its items.
+func splitList(s string) []string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if s == "" {
+		return []string{}
+	}
+
+	return splitOptions(s)
+}
+
+// shellQuote quotes s for a posix shell when it contains special characters.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\$`!*?[]{}()<>|&;#~") {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func deref[T any](list *[]T) []T {
+	if list == nil {
+		return nil
+	}
+
+	return *list
+}
+
+func orZero[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+
+	return *v
+}
@@ -0,0 +1,459 @@
+package sdk
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/units"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestConfigArgsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config api.VmConfig
+	}{
+		{
+			name: "kernel",
+			config: api.VmConfig{
+				Payload: api.PayloadConfig{
+					Kernel:    ptr("/boot/vmlinux"),
+					Initramfs: ptr("/boot/initrd"),
+					Cmdline:   ptr("console=ttyS0 root=/dev/vda1 rw"),
+				},
+				Cpus:   &api.CpusConfig{BootVcpus: 2, MaxVcpus: 2},
+				Memory: &api.MemoryConfig{Size: 512 * units.MiB},
+			},
+		},
+		{
+			name: "firmware",
+			config: api.VmConfig{
+				Payload: api.PayloadConfig{Firmware: ptr("/usr/share/hypervisor-fw")},
+			},
+		},
+		{
+			name: "cpus",
+			config: api.VmConfig{
+				Cpus: &api.CpusConfig{
+					BootVcpus:   2,
+					MaxVcpus:    8,
+					KvmHyperv:   ptr(true),
+					MaxPhysBits: ptr(40),
+					Topology: &api.CpuTopology{
+						ThreadsPerCore: ptr(2),
+						CoresPerDie:    ptr(2),
+						DiesPerPackage: ptr(1),
+						Packages:       ptr(2),
+					},
+					Affinity: &[]api.CpuAffinity{
+						{Vcpu: 0, HostCpus: []int{0, 2}},
+						{Vcpu: 1, HostCpus: []int{1, 3}},
+					},
+					Features: &api.CpuFeatures{Amx: ptr(true)},
+				},
+			},
+		},
+		{
+			name: "memory",
+			config: api.VmConfig{
+				Memory: &api.MemoryConfig{
+					Size:           0,
+					Mergeable:      ptr(false),
+					Shared:         ptr(true),
+					Hugepages:      ptr(true),
+					HugepageSize:   ptr[int64](2 * units.MiB),
+					HotplugMethod:  ptr("virtio-mem"),
+					HotplugSize:    ptr[int64](4 * units.GiB),
+					HotpluggedSize: ptr[int64](1536 * units.MiB),
+					Prefault:       ptr(true),
+					Thp:            ptr(false),
+					Zones: &[]api.MemoryZoneConfig{
+						{Id: "mem0", Size: units.GiB, HostNumaNode: ptr(int32(0))},
+						{
+							Id:             "mem1",
+							Size:           4097,
+							File:           ptr("/dev/shm/mem1"),
+							Shared:         ptr(true),
+							Hugepages:      ptr(false),
+							HugepageSize:   ptr[int64](units.GiB),
+							HotplugSize:    ptr[int64](units.KiB),
+							HotpluggedSize: ptr(int64(0)),
+							Prefault:       ptr(false),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "disks",
+			config: api.VmConfig{
+				RateLimitGroups: &[]api.RateLimitGroupConfig{
+					{
+						Id: "group0",
+						RateLimiterConfig: api.RateLimiterConfig{
+							Bandwidth: &api.TokenBucket{Size: 1000, RefillTime: 100},
+							Ops:       &api.TokenBucket{Size: 10, OneTimeBurst: ptr(int64(5)), RefillTime: 100},
+						},
+					},
+				},
+				Disks: &[]api.DiskConfig{
+					{
+						Id:             ptr("disk0"),
+						Path:           "/images/root.img",
+						Readonly:       ptr(false),
+						Direct:         ptr(true),
+						Iommu:          ptr(false),
+						NumQueues:      ptr(4),
+						QueueSize:      ptr(256),
+						PciSegment:     ptr(int16(1)),
+						Serial:         ptr("root"),
+						RateLimitGroup: ptr("group0"),
+						QueueAffinity: &[]api.VirtQueueAffinity{
+							{QueueIndex: 0, HostCpus: []int{0}},
+							{QueueIndex: 1, HostCpus: []int{1, 2, 3}},
+						},
+					},
+					{
+						Path:     "/images/data.img",
+						Readonly: ptr(true),
+						RateLimiterConfig: &api.RateLimiterConfig{
+							Bandwidth: &api.TokenBucket{Size: 1 << 20, OneTimeBurst: ptr(int64(1 << 20)), RefillTime: 1000},
+						},
+					},
+					{
+						VhostUser:   ptr(true),
+						VhostSocket: ptr("/run/vhost.sock"),
+					},
+				},
+			},
+		},
+		{
+			name: "net",
+			config: api.VmConfig{
+				Net: &[]api.NetConfig{
+					{
+						Id:        ptr("net0"),
+						Tap:       ptr("tap0"),
+						Ip:        ptr("192.168.249.1"),
+						Mask:      ptr("255.255.255.0"),
+						Mac:       ptr("12:34:56:78:90:ab"),
+						HostMac:   ptr("12:34:56:78:90:ac"),
+						Mtu:       ptr(1500),
+						Iommu:     ptr(false),
+						NumQueues: ptr(2),
+						QueueSize: ptr(256),
+						RateLimiterConfig: &api.RateLimiterConfig{
+							Ops: &api.TokenBucket{Size: 100, RefillTime: 10},
+						},
+					},
+					{
+						VhostUser:   ptr(true),
+						VhostSocket: ptr("/run/net.sock"),
+						VhostMode:   ptr("server"),
+						PciSegment:  ptr(int16(0)),
+					},
+				},
+			},
+		},
+		{
+			name: "devices",
+			config: api.VmConfig{
+				Rng:     &api.RngConfig{Src: "/dev/urandom", Iommu: ptr(false)},
+				Balloon: &api.BalloonConfig{Size: 256 * units.MiB, DeflateOnOom: ptr(true), FreePageReporting: ptr(false)},
+				Fs: &[]api.FsConfig{
+					{Id: ptr("fs0"), Tag: "share", Socket: "/run/fs.sock", NumQueues: 1, QueueSize: 1024, PciSegment: ptr(int16(0))},
+				},
+				Pmem: &[]api.PmemConfig{
+					{Id: ptr("pmem0"), File: "/images/pmem.img", Size: ptr[int64](128 * units.MiB), Iommu: ptr(false), DiscardWrites: ptr(true)},
+				},
+				Devices: &[]api.DeviceConfig{
+					{Id: ptr("gpu0"), Path: "/sys/bus/pci/devices/0000:01:00.0/", Iommu: ptr(true), XNvGpudirectClique: ptr(int8(1))},
+				},
+				Vdpa: &[]api.VdpaConfig{
+					{Id: ptr("vdpa0"), Path: "/dev/vhost-vdpa-0", NumQueues: 2, Iommu: ptr(true), PciSegment: ptr(int16(1))},
+				},
+				Vsock:    &api.VsockConfig{Id: ptr("vsock0"), Cid: 3, Socket: "/run/vsock.sock", Iommu: ptr(false)},
+				Pvpanic:  ptr(true),
+				Watchdog: ptr(true),
+				Tpm:      &api.TpmConfig{Socket: "/run/swtpm.sock"},
+			},
+		},
+		{
+			name: "consoles",
+			config: api.VmConfig{
+				Serial:       &api.ConsoleConfig{Mode: api.ConsoleConfigModeFile, File: ptr("/var/log/serial.log")},
+				Console:      &api.ConsoleConfig{Mode: api.ConsoleConfigModeOff},
+				DebugConsole: &api.DebugConsoleConfig{Mode: api.DebugConsoleConfigModePty, Iobase: ptr(0xe9)},
+			},
+		},
+		{
+			name: "console socket",
+			config: api.VmConfig{
+				Serial:       &api.ConsoleConfig{Mode: api.ConsoleConfigModeSocket, Socket: ptr("/run/serial.sock")},
+				Console:      &api.ConsoleConfig{Mode: api.ConsoleConfigModeTty, Iommu: ptr(true)},
+				DebugConsole: &api.DebugConsoleConfig{Mode: api.DebugConsoleConfigModeFile, File: ptr("/var/log/debug.log")},
+			},
+		},
+		{
+			name: "console null",
+			config: api.VmConfig{
+				Serial:  &api.ConsoleConfig{Mode: api.ConsoleConfigModeNull},
+				Console: &api.ConsoleConfig{Mode: api.ConsoleConfigModePty},
+			},
+		},
+		{
+			name: "numa",
+			config: api.VmConfig{
+				SgxEpc: &[]api.SgxEpcConfig{
+					{Id: "epc0", Size: 64 * units.MiB, Prefault: ptr(true)},
+				},
+				Numa: &[]api.NumaConfig{
+					{
+						GuestNumaId:    0,
+						Cpus:           &[]int32{0, 1, 2},
+						Distances:      &[]api.NumaDistance{{Destination: 1, Distance: 20}},
+						MemoryZones:    &[]string{"mem0"},
+						SgxEpcSections: &[]string{"epc0"},
+						PciSegments:    &[]int32{0},
+					},
+					{
+						GuestNumaId: 1,
+						Cpus:        &[]int32{3},
+						Distances:   &[]api.NumaDistance{{Destination: 0, Distance: 20}},
+						MemoryZones: &[]string{"mem1", "mem2"},
+					},
+				},
+			},
+		},
+		{
+			name: "platform",
+			config: api.VmConfig{
+				PciSegments: &[]api.PciSegmentConfig{
+					{PciSegment: 1, Mmio32ApertureWeight: ptr(int32(2)), Mmio64ApertureWeight: ptr(int32(4))},
+				},
+				Platform: &api.PlatformConfig{
+					NumPciSegments: ptr(int16(2)),
+					IommuSegments:  &[]int16{1},
+					SerialNumber:   ptr("abc123"),
+					Uuid:           ptr("1e8aa1f6-5a58-4a17-9d4c-3f5a3f3a1f1e"),
+					OemStrings:     &[]string{"one", "two"},
+					Tdx:            ptr(false),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := ConfigArgs(tt.config)
+
+			got, err := ParseConfigArgs(args)
+			if err != nil {
+				t.Fatalf("could not parse %q: %s", args, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.config) {
+				want, _ := json.Marshal(tt.config)
+				have, _ := json.Marshal(got)
+				t.Errorf("round trip of %q\n got %s\nwant %s", args, have, want)
+			}
+		})
+	}
+}
+
+func TestConfigArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config api.VmConfig
+		want   []string
+	}{
+		{
+			name:   "empty",
+			config: api.VmConfig{},
+			want:   []string{},
+		},
+		{
+			name: "sizes",
+			config: api.VmConfig{
+				Memory: &api.MemoryConfig{
+					Size:         1536 * units.MiB,
+					HugepageSize: ptr[int64](2 * units.MiB),
+					HotplugSize:  ptr[int64](4 * units.GiB),
+					Hugepages:    ptr(true),
+					Mergeable:    ptr(false),
+				},
+				Balloon: &api.BalloonConfig{Size: 1000},
+				Pmem:    &[]api.PmemConfig{{File: "/pmem", Size: ptr[int64](64 * units.KiB)}},
+			},
+			want: []string{
+				"--memory", "size=1536M,mergeable=off,hugepages=on,hugepage_size=2M,hotplug_size=4G",
+				"--balloon", "size=1000",
+				"--pmem", "file=/pmem,size=64K",
+			},
+		},
+		{
+			name: "rate limiter order",
+			config: api.VmConfig{
+				Disks: &[]api.DiskConfig{{
+					Path: "/disk",
+					RateLimiterConfig: &api.RateLimiterConfig{
+						Bandwidth: &api.TokenBucket{Size: 1, OneTimeBurst: ptr(int64(2)), RefillTime: 3},
+						Ops:       &api.TokenBucket{Size: 4, RefillTime: 5},
+					},
+				}},
+			},
+			want: []string{
+				"--disk", "path=/disk,bw_size=1,bw_one_time_burst=2,bw_refill_time=3,ops_size=4,ops_refill_time=5",
+			},
+		},
+		{
+			name: "flags",
+			config: api.VmConfig{
+				Payload:  api.PayloadConfig{Kernel: ptr("/vmlinux"), Cmdline: ptr("console=hvc0")},
+				Serial:   &api.ConsoleConfig{Mode: api.ConsoleConfigModeTty},
+				Pvpanic:  ptr(true),
+				Watchdog: ptr(false),
+			},
+			want: []string{
+				"--kernel", "/vmlinux",
+				"--cmdline", "console=hvc0",
+				"--serial", "tty",
+				"--pvpanic",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ConfigArgs(tt.config)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConfigArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConfigArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want api.VmConfig
+	}{
+		{
+			name: "several values",
+			args: []string{"--disk", "path=/a", "path=/b", "--kernel", "/k"},
+			want: api.VmConfig{
+				Payload: api.PayloadConfig{Kernel: ptr("/k")},
+				Disks:   &[]api.DiskConfig{{Path: "/a"}, {Path: "/b"}},
+			},
+		},
+		{
+			name: "repeated flags",
+			args: []string{"--disk", "path=/a", "--disk=path=/b"},
+			want: api.VmConfig{
+				Disks: &[]api.DiskConfig{{Path: "/a"}, {Path: "/b"}},
+			},
+		},
+		{
+			name: "vmm flags",
+			args: []string{"--api-socket", "/run/api.sock", "--disk", "path=/a", "-vv", "--event-monitor", "fd=3", "--pvpanic"},
+			want: api.VmConfig{
+				Disks:   &[]api.DiskConfig{{Path: "/a"}},
+				Pvpanic: ptr(true),
+			},
+		},
+		{
+			name: "ranges and defaults",
+			args: []string{"--cpus", "boot=4", "--numa", "guest_numa_id=0,cpus=[0-2,5]", "--memory", "size=1GiB,shared=true"},
+			want: api.VmConfig{
+				Cpus:   &api.CpusConfig{BootVcpus: 4, MaxVcpus: 4},
+				Memory: &api.MemoryConfig{Size: units.GiB, Shared: ptr(true)},
+				Numa:   &[]api.NumaConfig{{GuestNumaId: 0, Cpus: &[]int32{0, 1, 2, 5}}},
+			},
+		},
+		{
+			name: "zones before memory",
+			args: []string{"--memory-zone", "id=mem0,size=1G", "--memory", "size=0"},
+			want: api.VmConfig{
+				Memory: &api.MemoryConfig{Size: 0, Zones: &[]api.MemoryZoneConfig{{Id: "mem0", Size: units.GiB}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConfigArgs(tt.args)
+			if err != nil {
+				t.Fatalf("ParseConfigArgs(%q) returned error: %s", tt.args, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				want, _ := json.Marshal(tt.want)
+				have, _ := json.Marshal(got)
+				t.Errorf("ParseConfigArgs(%q)\n got %s\nwant %s", tt.args, have, want)
+			}
+		})
+	}
+}
+
+func TestParseConfigArgsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "unknown option", args: []string{"--disk", "path=/a,bogus=1"}, want: "--disk: unknown option bogus"},
+		{name: "flag after list", args: []string{"--disk", "path=/a", "-x"}, want: "-x"},
+		{name: "unknown flag", args: []string{"--bogus", "x"}, want: "--bogus: unsupported argument"},
+		{name: "bad bool", args: []string{"--disk", "path=/a,readonly=yes"}, want: "readonly: invalid value"},
+		{name: "bad size", args: []string{"--memory", "size=lots"}, want: `invalid size "lots"`},
+		{name: "bad int", args: []string{"--cpus", "boot=two"}, want: "--cpus: boot"},
+		{name: "overflow", args: []string{"--disk", "path=/a,pci_segment=70000"}, want: "--disk: pci_segment"},
+		{name: "missing value", args: []string{"--kernel"}, want: "--kernel: missing value"},
+		{name: "duplicate option", args: []string{"--disk", "path=/a,path=/b"}, want: "duplicate option path"},
+		{name: "positional", args: []string{"vmlinux"}, want: `unexpected argument "vmlinux"`},
+		{name: "topology", args: []string{"--cpus", "boot=1,topology=1:2"}, want: "invalid topology"},
+		{name: "console mode", args: []string{"--serial", "iommu=on"}, want: "missing mode"},
+		{name: "range", args: []string{"--numa", "guest_numa_id=0,cpus=[3-1]"}, want: `invalid list item "3-1"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfigArgs(tt.args)
+			if err == nil {
+				t.Fatalf("ParseConfigArgs(%q) returned no error", tt.args)
+			}
+
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseConfigArgs(%q) = %q, want it to contain %q", tt.args, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "--kernel", want: "--kernel"},
+		{in: "path=/a,readonly=on", want: "path=/a,readonly=on"},
+		{in: "", want: "''"},
+		{in: "console=ttyS0 rw", want: "'console=ttyS0 rw'"},
+		{in: "cpus=[0,1]", want: "'cpus=[0,1]'"},
+		{in: "it's", want: `'it'\''s'`},
+	}
+
+	for _, tt := range tests {
+		got := shellQuote(tt.in)
+		if got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
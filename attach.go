@@ -0,0 +1,131 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/internal/proc"
+)
+
+const pidPollInterval = 500 * time.Millisecond
+
+// vmStates maps the state reported by the vmm to the state of the machine.
+var vmStates = map[api.VmInfoState]State{
+	api.Created:  StateCreated,
+	api.Running:  StateRunning,
+	api.Paused:   StatePaused,
+	api.Shutdown: StateShutdown,
+}
+
+// AttachMachine connects to a cloud-hypervisor process that is already
+// running, e.g. one started by an earlier run of the program, and returns a
+// machine for it. Wait returns once the process exits, events of the vmm are
+// not available to attached machines.
+func AttachMachine(ctx context.Context, socketPath string, opts ...Option) (Machine, error) {
+	socketPath, err := filepath.Abs(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := defaultMachine(ctx, api.VmConfig{}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	m.socketPath = socketPath
+
+	// machines started by the sdk keep their id and runtime dir, other runtime
+	// dirs are left alone
+	dir := filepath.Dir(socketPath)
+	if filepath.Dir(dir) == runtimeBaseDir() {
+		m.id = filepath.Base(dir)
+		m.runtimeDir = dir
+		m.createdRuntimeDir = true
+
+		err = m.writeOwnerFile()
+		if err != nil {
+			return nil, err
+		}
+	} else if m.runtimeDir == "" {
+		m.runtimeDir = dir
+		m.keepRuntimeDir = true
+	}
+
+	m.client, err = newClient(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ping, err := m.vmmPing(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if ping.Pid == nil {
+		return nil, fmt.Errorf("vmm %s did not report its pid", ping.Version)
+	}
+
+	pid := int(*ping.Pid)
+	startedAt, err := proc.StartTime(pid)
+	if err != nil {
+		startedAt = time.Now()
+	}
+
+	m.setProcess(pid, startedAt)
+
+	m.state = StateVMMStarting
+
+	info, err := m.Info(ctx)
+	switch {
+	case errors.Is(err, ErrVMNotCreated):
+	case err != nil:
+		return nil, err
+	default:
+		m.config = info.Config
+		m.state = vmStates[info.State]
+	}
+
+	// the machine can not be started again and has no event monitor
+	m.startOnce.Do(func() {})
+	m.eventsDone = true
+
+	go m.watchPID()
+
+	return m, nil
+}
+
+// watchPID marks the machine as exited once the process with its pid is gone,
+// for processes that are not children of this process.
+func (m *MachineImpl) watchPID() {
+	ticker := time.NewTicker(pidPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.exitCh:
+			return
+		case <-ticker.C:
+		}
+
+		if !processExists(m.vmmPID()) {
+			m.exit(nil)
+			return
+		}
+	}
+}
+
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,335 @@
+package sdk
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/units"
+)
+
+const (
+	defaultVcpus     = 1
+	defaultMemory    = 512 << 20
+	defaultQueues    = 1
+	defaultQueueSize = 1024
+)
+
+// ConfigBuilder builds a vm config without the pointers the api types need.
+// Devices get ids in the order they are added, e.g. disk0, disk1 and net0.
+// Errors are collected and returned by Build.
+type ConfigBuilder struct {
+	config api.VmConfig
+	errs   []error
+}
+
+// NewConfigBuilder creates a builder for a vm with 1 vcpu and 512MiB of memory.
+func NewConfigBuilder() *ConfigBuilder {
+	return &ConfigBuilder{
+		config: api.VmConfig{
+			Cpus: &api.CpusConfig{
+				BootVcpus: defaultVcpus,
+				MaxVcpus:  defaultVcpus,
+			},
+			Memory: &api.MemoryConfig{
+				Size: defaultMemory,
+			},
+		},
+	}
+}
+
+// WithKernel boots the vm from the kernel at path.
+func (b *ConfigBuilder) WithKernel(path string) *ConfigBuilder {
+	b.config.Payload.Kernel = b.path("payload.kernel", path)
+	return b
+}
+
+// WithFirmware boots the vm from the firmware at path.
+func (b *ConfigBuilder) WithFirmware(path string) *ConfigBuilder {
+	b.config.Payload.Firmware = b.path("payload.firmware", path)
+	return b
+}
+
+// WithInitramfs loads the initramfs at path.
+func (b *ConfigBuilder) WithInitramfs(path string) *ConfigBuilder {
+	b.config.Payload.Initramfs = b.path("payload.initramfs", path)
+	return b
+}
+
+// WithCmdline sets the kernel command line.
+func (b *ConfigBuilder) WithCmdline(cmdline string) *ConfigBuilder {
+	b.config.Payload.Cmdline = &cmdline
+	return b
+}
+
+// WithCPUs boots the vm with boot vcpus, max is the number of vcpus it can be
+// resized to.
+func (b *ConfigBuilder) WithCPUs(boot int, max int) *ConfigBuilder {
+	b.config.Cpus.BootVcpus = boot
+	b.config.Cpus.MaxVcpus = max
+	return b
+}
+
+// WithMemory sets the memory of the vm, e.g. 512M or 1GiB.
+func (b *ConfigBuilder) WithMemory(size string) *ConfigBuilder {
+	bytes := b.size("memory.size", size)
+	if bytes == nil {
+		return b
+	}
+
+	b.config.Memory.Size = *bytes
+	return b
+}
+
+// WithHugepages backs the memory of the vm with hugepages of the given size,
+// e.g. 2M or 1G. The memory has to be a multiple of the hugepage size.
+func (b *ConfigBuilder) WithHugepages(size string) *ConfigBuilder {
+	bytes := b.size("memory.hugepage_size", size)
+	if bytes == nil {
+		return b
+	}
+
+	hugepages := true
+	b.config.Memory.Hugepages = &hugepages
+	b.config.Memory.HugepageSize = bytes
+	return b
+}
+
+// WithBalloon adds a balloon device that starts out inflated to size, e.g.
+// 256M, the memory it holds is not available to the guest.
+func (b *ConfigBuilder) WithBalloon(size string) *ConfigBuilder {
+	bytes := b.size("balloon.size", size)
+	if bytes == nil {
+		return b
+	}
+
+	b.config.Balloon = &api.BalloonConfig{
+		Size: *bytes,
+	}
+
+	return b
+}
+
+// AddPmem adds a persistent memory device backed by the file at path. The
+// size, e.g. 1G, is the size of the device, an empty size uses the size of
+// the file.
+func (b *ConfigBuilder) AddPmem(path string, size string) *ConfigBuilder {
+	index := length(b.config.Pmem)
+
+	abs := b.path(fmt.Sprintf("pmem[%d].file", index), path)
+	if abs == nil {
+		return b
+	}
+
+	pmem := api.PmemConfig{
+		Id:   b.id("pmem", index),
+		File: *abs,
+	}
+
+	if size != "" {
+		pmem.Size = b.size(fmt.Sprintf("pmem[%d].size", index), size)
+		if pmem.Size == nil {
+			return b
+		}
+	}
+
+	b.config.Pmem = appendDevice(b.config.Pmem, pmem)
+	return b
+}
+
+// AddSgxEpc adds an sgx enclave page cache section of the given size, e.g.
+// 64M.
+func (b *ConfigBuilder) AddSgxEpc(size string) *ConfigBuilder {
+	index := length(b.config.SgxEpc)
+
+	bytes := b.size(fmt.Sprintf("sgx_epc[%d].size", index), size)
+	if bytes == nil {
+		return b
+	}
+
+	b.config.SgxEpc = appendDevice(b.config.SgxEpc, api.SgxEpcConfig{
+		Id:   *b.id("epc", index),
+		Size: *bytes,
+	})
+
+	return b
+}
+
+// AddDisk adds a writable disk backed by the image at path.
+func (b *ConfigBuilder) AddDisk(path string) *ConfigBuilder {
+	return b.addDisk(path, false)
+}
+
+// AddReadonlyDisk adds a readonly disk backed by the image at path.
+func (b *ConfigBuilder) AddReadonlyDisk(path string) *ConfigBuilder {
+	return b.addDisk(path, true)
+}
+
+func (b *ConfigBuilder) addDisk(path string, readonly bool) *ConfigBuilder {
+	field := fmt.Sprintf("disks[%d].path", length(b.config.Disks))
+
+	abs := b.path(field, path)
+	if abs == nil {
+		return b
+	}
+
+	b.config.Disks = appendDevice(b.config.Disks, api.DiskConfig{
+		Id:       b.id("disk", length(b.config.Disks)),
+		Path:     *abs,
+		Readonly: &readonly,
+	})
+
+	return b
+}
+
+// AddNet adds a network interface with the given mac address, an empty mac
+// lets cloud-hypervisor pick one.
+func (b *ConfigBuilder) AddNet(mac string) *ConfigBuilder {
+	net := api.NetConfig{
+		Id: b.id("net", length(b.config.Net)),
+	}
+
+	if mac != "" {
+		net.Mac = &mac
+	}
+
+	b.config.Net = appendDevice(b.config.Net, net)
+	return b
+}
+
+// AddFs adds a virtio-fs share the guest mounts by tag, served by a virtiofsd
+// the caller runs on socket. Virtio-fs needs shared memory, which is turned
+// on. Use WithShare to let the machine run the virtiofsd instead.
+func (b *ConfigBuilder) AddFs(tag string, socket string) *ConfigBuilder {
+	if socket == "" {
+		b.errs = append(b.errs, fmt.Errorf("fs.socket: a virtiofsd socket is required, use WithShare to run one"))
+		return b
+	}
+
+	path := b.path("fs.socket", socket)
+	if path == nil {
+		return b
+	}
+
+	b.config.Fs = appendDevice(b.config.Fs, api.FsConfig{
+		Id:        b.id("fs", length(b.config.Fs)),
+		Tag:       tag,
+		Socket:    *path,
+		NumQueues: defaultQueues,
+		QueueSize: defaultQueueSize,
+	})
+
+	shared := true
+	b.config.Memory.Shared = &shared
+	return b
+}
+
+// WithSerialFile writes the serial output of the vm to path, an empty path
+// puts it in the runtime dir of the machine.
+func (b *ConfigBuilder) WithSerialFile(path string) *ConfigBuilder {
+	b.config.Serial = &api.ConsoleConfig{
+		Mode: api.ConsoleConfigModeFile,
+	}
+
+	if path != "" {
+		b.config.Serial.File = b.path("serial.file", path)
+	}
+
+	return b
+}
+
+// WithVsock adds a vsock device with a random cid, its socket is created in the
+// runtime dir of the machine.
+func (b *ConfigBuilder) WithVsock() *ConfigBuilder {
+	cid, err := newCID()
+	if err != nil {
+		b.errs = append(b.errs, fmt.Errorf("vsock.cid: %w", err))
+		return b
+	}
+
+	b.config.Vsock = &api.VsockConfig{
+		Id:  b.id("vsock", 0),
+		Cid: cid,
+	}
+
+	return b
+}
+
+// Build validates the config and returns it. Files and sockets that are left
+// empty and are placed in the runtime dir by NewMachine are not reported.
+func (b *ConfigBuilder) Build() (api.VmConfig, error) {
+	if len(b.errs) > 0 {
+		return api.VmConfig{}, errors.Join(b.errs...)
+	}
+
+	// the config does not share pointers with the builder, so later calls do
+	// not change it
+	config, err := copyConfig(b.config)
+	if err != nil {
+		return api.VmConfig{}, err
+	}
+
+	// validate it with the runtime paths filled in the way NewMachine does
+	m := &MachineImpl{runtimeDir: runtimeBaseDir()}
+	m.config, err = copyConfig(config)
+	if err != nil {
+		return api.VmConfig{}, err
+	}
+
+	m.setRuntimePaths()
+
+	err = m.config.Validate()
+	if err != nil {
+		return api.VmConfig{}, err
+	}
+
+	return config, nil
+}
+
+func (b *ConfigBuilder) path(field string, path string) *string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		b.errs = append(b.errs, fmt.Errorf("%s: %w", field, err))
+		return nil
+	}
+
+	return &abs
+}
+
+func (b *ConfigBuilder) size(field string, size string) *int64 {
+	bytes, err := units.ParseSize(size)
+	if err != nil {
+		b.errs = append(b.errs, fmt.Errorf("%s: %w", field, err))
+		return nil
+	}
+
+	return &bytes
+}
+
+func (b *ConfigBuilder) id(prefix string, index int) *string {
+	id := prefix + strconv.Itoa(index)
+	return &id
+}
+
+func length[T any](devices *[]T) int {
+	if devices == nil {
+		return 0
+	}
+
+	return len(*devices)
+}
+
+// newCID returns a random vsock context id, 0 to 2 are reserved.
+func newCID() (int64, error) {
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(binary.BigEndian.Uint32(b)>>1) + 3, nil
+}
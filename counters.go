@@ -0,0 +1,189 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+// DiskCounters holds the io counters of a block device.
+type DiskCounters struct {
+	ReadBytes  int64
+	WriteBytes int64
+	ReadOps    int64
+	WriteOps   int64
+}
+
+// NetCounters holds the io counters of a network device.
+type NetCounters struct {
+	RxBytes   int64
+	TxBytes   int64
+	RxPackets int64
+	TxPackets int64
+}
+
+// Counters is a sample of the device counters of a vm, keyed by device id.
+type Counters struct {
+	Time  time.Time
+	Disks map[string]DiskCounters
+	Nets  map[string]NetCounters
+	// Raw holds the counters as reported by the vmm, including devices that
+	// are not disks or network devices.
+	Raw api.VmCounters
+}
+
+// DiskRate is the io rate of a block device, per second.
+type DiskRate struct {
+	ReadBytes  float64
+	WriteBytes float64
+	ReadOps    float64
+	WriteOps   float64
+}
+
+// NetRate is the io rate of a network device, per second.
+type NetRate struct {
+	RxBytes   float64
+	TxBytes   float64
+	RxPackets float64
+	TxPackets float64
+}
+
+// CountersDelta is the difference between two samples of device counters.
+type CountersDelta struct {
+	Interval time.Duration
+	Disks    map[string]DiskCounters
+	Nets     map[string]NetCounters
+}
+
+// Counters samples the device counters of the vm.
+func (m *MachineImpl) Counters(ctx context.Context) (*Counters, error) {
+	resp, err := m.client.GetVmCounters(ctx)
+	err = checkResponse("get vm counters", resp, err, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	counters, err := api.ParseGetVmCountersResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := api.VmCounters{}
+	if counters.JSON200 != nil {
+		raw = *counters.JSON200
+	}
+
+	return newCounters(time.Now(), raw), nil
+}
+
+func newCounters(now time.Time, raw api.VmCounters) *Counters {
+	c := &Counters{
+		Time:  now,
+		Disks: map[string]DiskCounters{},
+		Nets:  map[string]NetCounters{},
+		Raw:   raw,
+	}
+
+	for id, values := range raw {
+		if _, ok := values["read_bytes"]; ok {
+			c.Disks[id] = DiskCounters{
+				ReadBytes:  values["read_bytes"],
+				WriteBytes: values["write_bytes"],
+				ReadOps:    values["read_ops"],
+				WriteOps:   values["write_ops"],
+			}
+			continue
+		}
+
+		if _, ok := values["rx_bytes"]; ok {
+			c.Nets[id] = NetCounters{
+				RxBytes:   values["rx_bytes"],
+				TxBytes:   values["tx_bytes"],
+				RxPackets: values["rx_frames"],
+				TxPackets: values["tx_frames"],
+			}
+		}
+	}
+
+	return c
+}
+
+// Sub returns the difference between c and an earlier sample. Devices that
+// are missing from the earlier sample are counted from zero, counters that
+// went backwards because the device was replaced start again from zero. A nil
+// sample counts every device from zero, with no interval to compute rates
+// over.
+func (c *Counters) Sub(previous *Counters) *CountersDelta {
+	if previous == nil {
+		previous = &Counters{Time: c.Time}
+	}
+
+	d := &CountersDelta{
+		Interval: c.Time.Sub(previous.Time),
+		Disks:    map[string]DiskCounters{},
+		Nets:     map[string]NetCounters{},
+	}
+
+	for id, current := range c.Disks {
+		before := previous.Disks[id]
+		d.Disks[id] = DiskCounters{
+			ReadBytes:  counterDelta(current.ReadBytes, before.ReadBytes),
+			WriteBytes: counterDelta(current.WriteBytes, before.WriteBytes),
+			ReadOps:    counterDelta(current.ReadOps, before.ReadOps),
+			WriteOps:   counterDelta(current.WriteOps, before.WriteOps),
+		}
+	}
+
+	for id, current := range c.Nets {
+		before := previous.Nets[id]
+		d.Nets[id] = NetCounters{
+			RxBytes:   counterDelta(current.RxBytes, before.RxBytes),
+			TxBytes:   counterDelta(current.TxBytes, before.TxBytes),
+			RxPackets: counterDelta(current.RxPackets, before.RxPackets),
+			TxPackets: counterDelta(current.TxPackets, before.TxPackets),
+		}
+	}
+
+	return d
+}
+
+// DiskRate returns the per second io rate of the disk with the given id.
+func (d *CountersDelta) DiskRate(id string) DiskRate {
+	delta := d.Disks[id]
+	return DiskRate{
+		ReadBytes:  d.perSecond(delta.ReadBytes),
+		WriteBytes: d.perSecond(delta.WriteBytes),
+		ReadOps:    d.perSecond(delta.ReadOps),
+		WriteOps:   d.perSecond(delta.WriteOps),
+	}
+}
+
+// NetRate returns the per second io rate of the network device with the
+// given id.
+func (d *CountersDelta) NetRate(id string) NetRate {
+	delta := d.Nets[id]
+	return NetRate{
+		RxBytes:   d.perSecond(delta.RxBytes),
+		TxBytes:   d.perSecond(delta.TxBytes),
+		RxPackets: d.perSecond(delta.RxPackets),
+		TxPackets: d.perSecond(delta.TxPackets),
+	}
+}
+
+func (d *CountersDelta) perSecond(value int64) float64 {
+	if d.Interval <= 0 {
+		return 0
+	}
+
+	return float64(value) / d.Interval.Seconds()
+}
+
+func counterDelta(current int64, previous int64) int64 {
+	if current < previous {
+		return current
+	}
+
+	return current - previous
+}
@@ -0,0 +1,212 @@
+package sdk
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+func TestNewCounters(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name      string
+		raw       api.VmCounters
+		wantDisks map[string]DiskCounters
+		wantNets  map[string]NetCounters
+	}{
+		{
+			name:      "empty",
+			raw:       api.VmCounters{},
+			wantDisks: map[string]DiskCounters{},
+			wantNets:  map[string]NetCounters{},
+		},
+		{
+			name: "devices",
+			raw: api.VmCounters{
+				"disk0": {"read_bytes": 4096, "write_bytes": 512, "read_ops": 8, "write_ops": 1},
+				"net0":  {"rx_bytes": 1500, "tx_bytes": 600, "rx_frames": 3, "tx_frames": 2},
+				"rng0":  {"entropy_bytes": 64},
+			},
+			wantDisks: map[string]DiskCounters{
+				"disk0": {ReadBytes: 4096, WriteBytes: 512, ReadOps: 8, WriteOps: 1},
+			},
+			wantNets: map[string]NetCounters{
+				"net0": {RxBytes: 1500, TxBytes: 600, RxPackets: 3, TxPackets: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newCounters(now, tt.raw)
+
+			if !got.Time.Equal(now) {
+				t.Errorf("Time = %s, want %s", got.Time, now)
+			}
+
+			if !reflect.DeepEqual(got.Disks, tt.wantDisks) {
+				t.Errorf("Disks = %+v, want %+v", got.Disks, tt.wantDisks)
+			}
+
+			if !reflect.DeepEqual(got.Nets, tt.wantNets) {
+				t.Errorf("Nets = %+v, want %+v", got.Nets, tt.wantNets)
+			}
+
+			if !reflect.DeepEqual(got.Raw, tt.raw) {
+				t.Errorf("Raw = %+v, want %+v", got.Raw, tt.raw)
+			}
+		})
+	}
+}
+
+func TestCountersSub(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		current  *Counters
+		previous *Counters
+		want     *CountersDelta
+	}{
+		{
+			name: "growing counters",
+			current: &Counters{
+				Time:  start.Add(2 * time.Second),
+				Disks: map[string]DiskCounters{"disk0": {ReadBytes: 6000, WriteBytes: 300, ReadOps: 10, WriteOps: 3}},
+				Nets:  map[string]NetCounters{"net0": {RxBytes: 2000, TxBytes: 1000, RxPackets: 20, TxPackets: 10}},
+			},
+			previous: &Counters{
+				Time:  start,
+				Disks: map[string]DiskCounters{"disk0": {ReadBytes: 2000, WriteBytes: 100, ReadOps: 4, WriteOps: 1}},
+				Nets:  map[string]NetCounters{"net0": {RxBytes: 1000, TxBytes: 400, RxPackets: 10, TxPackets: 4}},
+			},
+			want: &CountersDelta{
+				Interval: 2 * time.Second,
+				Disks:    map[string]DiskCounters{"disk0": {ReadBytes: 4000, WriteBytes: 200, ReadOps: 6, WriteOps: 2}},
+				Nets:     map[string]NetCounters{"net0": {RxBytes: 1000, TxBytes: 600, RxPackets: 10, TxPackets: 6}},
+			},
+		},
+		{
+			name: "replaced device",
+			current: &Counters{
+				Time:  start.Add(time.Second),
+				Disks: map[string]DiskCounters{"disk0": {ReadBytes: 100, WriteBytes: 500, ReadOps: 1, WriteOps: 5}},
+				Nets:  map[string]NetCounters{"net0": {RxBytes: 50, TxBytes: 2000, RxPackets: 1, TxPackets: 20}},
+			},
+			previous: &Counters{
+				Time:  start,
+				Disks: map[string]DiskCounters{"disk0": {ReadBytes: 4000, WriteBytes: 400, ReadOps: 8, WriteOps: 4}},
+				Nets:  map[string]NetCounters{"net0": {RxBytes: 1000, TxBytes: 1000, RxPackets: 10, TxPackets: 10}},
+			},
+			want: &CountersDelta{
+				Interval: time.Second,
+				Disks:    map[string]DiskCounters{"disk0": {ReadBytes: 100, WriteBytes: 100, ReadOps: 1, WriteOps: 1}},
+				Nets:     map[string]NetCounters{"net0": {RxBytes: 50, TxBytes: 1000, RxPackets: 1, TxPackets: 10}},
+			},
+		},
+		{
+			name: "missing device",
+			current: &Counters{
+				Time:  start.Add(time.Second),
+				Disks: map[string]DiskCounters{"disk0": {ReadBytes: 100}, "disk1": {ReadBytes: 300, ReadOps: 3}},
+				Nets:  map[string]NetCounters{"net1": {RxBytes: 70, RxPackets: 1}},
+			},
+			previous: &Counters{
+				Time:  start,
+				Disks: map[string]DiskCounters{"disk0": {ReadBytes: 40}},
+				Nets:  map[string]NetCounters{"net0": {RxBytes: 1000}},
+			},
+			want: &CountersDelta{
+				Interval: time.Second,
+				Disks:    map[string]DiskCounters{"disk0": {ReadBytes: 60}, "disk1": {ReadBytes: 300, ReadOps: 3}},
+				Nets:     map[string]NetCounters{"net1": {RxBytes: 70, RxPackets: 1}},
+			},
+		},
+		{
+			name: "no previous sample",
+			current: &Counters{
+				Time:  start,
+				Disks: map[string]DiskCounters{"disk0": {ReadBytes: 100, WriteOps: 2}},
+				Nets:  map[string]NetCounters{"net0": {TxBytes: 80, TxPackets: 1}},
+			},
+			want: &CountersDelta{
+				Disks: map[string]DiskCounters{"disk0": {ReadBytes: 100, WriteOps: 2}},
+				Nets:  map[string]NetCounters{"net0": {TxBytes: 80, TxPackets: 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.current.Sub(tt.previous)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sub() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountersDeltaRates(t *testing.T) {
+	tests := []struct {
+		name     string
+		delta    *CountersDelta
+		id       string
+		wantDisk DiskRate
+		wantNet  NetRate
+	}{
+		{
+			name: "per second",
+			delta: &CountersDelta{
+				Interval: 2 * time.Second,
+				Disks:    map[string]DiskCounters{"dev0": {ReadBytes: 4096, WriteBytes: 1024, ReadOps: 8, WriteOps: 2}},
+				Nets:     map[string]NetCounters{"dev0": {RxBytes: 3000, TxBytes: 1000, RxPackets: 6, TxPackets: 2}},
+			},
+			id:       "dev0",
+			wantDisk: DiskRate{ReadBytes: 2048, WriteBytes: 512, ReadOps: 4, WriteOps: 1},
+			wantNet:  NetRate{RxBytes: 1500, TxBytes: 500, RxPackets: 3, TxPackets: 1},
+		},
+		{
+			name: "sub second interval",
+			delta: &CountersDelta{
+				Interval: 500 * time.Millisecond,
+				Disks:    map[string]DiskCounters{"dev0": {ReadBytes: 100}},
+				Nets:     map[string]NetCounters{"dev0": {TxPackets: 5}},
+			},
+			id:       "dev0",
+			wantDisk: DiskRate{ReadBytes: 200},
+			wantNet:  NetRate{TxPackets: 10},
+		},
+		{
+			name: "no interval",
+			delta: &CountersDelta{
+				Disks: map[string]DiskCounters{"dev0": {ReadBytes: 100}},
+				Nets:  map[string]NetCounters{"dev0": {RxBytes: 100}},
+			},
+			id: "dev0",
+		},
+		{
+			name: "unknown device",
+			delta: &CountersDelta{
+				Interval: time.Second,
+				Disks:    map[string]DiskCounters{},
+				Nets:     map[string]NetCounters{},
+			},
+			id: "dev1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.delta.DiskRate(tt.id); got != tt.wantDisk {
+				t.Errorf("DiskRate(%q) = %+v, want %+v", tt.id, got, tt.wantDisk)
+			}
+
+			if got := tt.delta.NetRate(tt.id); got != tt.wantNet {
+				t.Errorf("NetRate(%q) = %+v, want %+v", tt.id, got, tt.wantNet)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+// Coredump writes an elf coredump of the guest to path. A running vm is
+// paused while the dump is written and resumed afterwards.
+func (m *MachineImpl) Coredump(ctx context.Context, path string) error {
+	err := m.requireState("coredump vm", StateRunning, StatePaused)
+	if err != nil {
+		return err
+	}
+
+	path, err = localPath(path)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", filepath.Dir(path))
+	}
+
+	paused := false
+	if m.State() == StateRunning {
+		err = m.Pause(ctx)
+		if err != nil {
+			return err
+		}
+
+		paused = true
+	}
+
+	err = m.coredump(ctx, path)
+
+	if paused {
+		resumeErr := m.Resume(ctx)
+		if resumeErr != nil {
+			return errors.Join(err, resumeErr)
+		}
+	}
+
+	return err
+}
+
+// coredump writes an elf coredump of the guest to path, the vm must be paused.
+func (m *MachineImpl) coredump(ctx context.Context, path string) error {
+	url := fileScheme + path
+	resp, err := m.client.PutVmCoredump(ctx, api.VmCoredumpData{
+		DestinationUrl: &url,
+	})
+	return checkResponse("coredump vm", resp, err, http.StatusNoContent)
+}
+
+// InjectNMI injects a non maskable interrupt into every vcpu of the vm, which
+// makes a hung linux guest print its backtraces or panic, depending on its
+// configuration.
+func (m *MachineImpl) InjectNMI(ctx context.Context) error {
+	err := m.requireState("inject nmi", StateRunning)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.PutVmmNmi(ctx)
+	return checkResponse("inject nmi", resp, err, http.StatusNoContent)
+}
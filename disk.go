@@ -2,7 +2,6 @@ package sdk
 
 import (
 	_ "embed"
-	"fmt"
 	"os"
 	"path/filepath"
 	"text/template"
@@ -10,6 +9,15 @@ import (
 	"github.com/kdomanski/iso9660"
 )
 
+const (
+	// cloudInitPattern names the hidden dirs in the runtime base dir that the
+	// cloud-init files are staged in, GC removes the ones a crash left behind.
+	cloudInitPattern = ".cloudinit-*"
+	// cloudInitDisk is the name of the disk CreateCloudInitDisk writes to the
+	// temp dir.
+	cloudInitDisk = "cloudinit.iso"
+)
+
 //go:embed configs/meta-data.tmpl
 var metadata string
 
@@ -19,37 +27,50 @@ var userdata string
 //go:embed configs/network-config.tmpl
 var networkConfig string
 
+// CreateCloudInitDisk writes a cloud-init disk that sets the hostname, creates
+// the user and configures the interface with the given mac address, and
+// returns its path. The disk is written to the temp dir and belongs to the
+// caller, add it to the config of a machine or attach it to a running machine
+// with AddDisk.
 func CreateCloudInitDisk(hostname string, mac string, cidr string, gateway string, username string, password string) (string, error) {
-	source, err := os.MkdirTemp("", "cloudinit-*")
+	destination := filepath.Join(os.TempDir(), cloudInitDisk)
+	err := createCloudInitDisk(destination, hostname, mac, cidr, gateway, username, password)
 	if err != nil {
 		return "", err
 	}
 
-	fmt.Println(source)
+	return destination, nil
+}
 
-	err = generateMetadata(source, hostname)
+func createCloudInitDisk(destination string, hostname string, mac string, cidr string, gateway string, username string, password string) error {
+	base := runtimeBaseDir()
+	err := os.MkdirAll(base, 0700)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	err = generateUserdata(source, username, password)
+	source, err := os.MkdirTemp(base, cloudInitPattern)
 	if err != nil {
-		return "", err
+		return err
 	}
+	defer os.RemoveAll(source)
 
-	err = generateNetworkConfig(source, mac, cidr, gateway)
+	err = generateMetadata(source, hostname)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	// check if machine is already running ... cant add disk then.
-	destination, _ := filepath.Abs("/tmp/cloudinit.iso")
-	err = createISO9660Disk(source, "cidata", destination)
+	err = generateUserdata(source, username, password)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	return destination, nil
+	err = generateNetworkConfig(source, mac, cidr, gateway)
+	if err != nil {
+		return err
+	}
+
+	return createISO9660Disk(source, "cidata", destination)
 }
 
 func createISO9660Disk(source string, label string, destination string) error {
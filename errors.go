@@ -0,0 +1,89 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrVMNotCreated is returned when an operation requires a vm but the vmm
+	// has none, the vmm responds with 404 in that case.
+	ErrVMNotCreated = errors.New("vm not created")
+	// ErrInvalidState is returned when the vm is not in a state that allows
+	// the operation, the vmm responds with 405 in that case.
+	ErrInvalidState = errors.New("vm is in an invalid state for this operation")
+	// ErrVMMUnavailable is returned when the api socket of the vmm can not be
+	// reached.
+	ErrVMMUnavailable = errors.New("vmm unavailable")
+	// ErrNoHotplugHeadroom is returned when a vm is resized beyond the
+	// limits it was created with.
+	ErrNoHotplugHeadroom = errors.New("vm was created without hotplug headroom")
+	// ErrGuestPanicked is returned by Wait when the guest kernel panicked.
+	ErrGuestPanicked = errors.New("guest panicked")
+	// ErrMachineNotFound is returned when a machine is not in the registry.
+	ErrMachineNotFound = errors.New("machine not found")
+	// ErrVMMExitedEarly is returned by Start and Wait when the vmm exits
+	// before its api is up, even with exit status 0.
+	ErrVMMExitedEarly = errors.New("vmm exited before its api was ready")
+)
+
+// APIError is returned when the vmm responds to a request with an unexpected
+// status code.
+type APIError struct {
+	// Operation is the operation that was requested, e.g. "pause vm".
+	Operation string
+	// StatusCode is the http status code returned by the vmm.
+	StatusCode int
+	// Body is the error message returned by the vmm.
+	Body string
+}
+
+func (e *APIError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("could not %s: %s", e.Operation, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("could not %s: %s: %s", e.Operation, http.StatusText(e.StatusCode), e.Body)
+}
+
+// Is reports whether the status code of the error matches one of the
+// sentinel errors.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrVMNotCreated:
+		return e.StatusCode == http.StatusNotFound
+	case ErrInvalidState:
+		return e.StatusCode == http.StatusMethodNotAllowed
+	}
+
+	return false
+}
+
+// checkResponse turns the result of an api.Client call into an error.
+// Responses without content are closed, other successful responses are left
+// for the caller to parse.
+func checkResponse(operation string, resp *http.Response, err error, expected int) error {
+	if err != nil {
+		return fmt.Errorf("could not %s: %w: %w", operation, ErrVMMUnavailable, err)
+	}
+
+	if resp.StatusCode == expected {
+		if expected == http.StatusNoContent {
+			resp.Body.Close()
+		}
+
+		return nil
+	}
+
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	return &APIError{
+		Operation:  operation,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
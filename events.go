@@ -0,0 +1,203 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// eventMonitorFD is the file descriptor the vmm writes events to, the first
+// of cmd.ExtraFiles.
+const eventMonitorFD = 3
+
+// EventSource is the component of the vmm that emitted an event.
+type EventSource string
+
+const (
+	EventSourceVMM    EventSource = "vmm"
+	EventSourceVM     EventSource = "vm"
+	EventSourceGuest  EventSource = "guest"
+	EventSourceDevice EventSource = "virtio-device"
+)
+
+// EventType is what happened in the vmm.
+type EventType string
+
+const (
+	EventStarting      EventType = "starting"
+	EventBooting       EventType = "booting"
+	EventBooted        EventType = "booted"
+	EventPausing       EventType = "pausing"
+	EventPaused        EventType = "paused"
+	EventResuming      EventType = "resuming"
+	EventResumed       EventType = "resumed"
+	EventSnapshotting  EventType = "snapshotting"
+	EventSnapshotted   EventType = "snapshotted"
+	EventRestoring     EventType = "restoring"
+	EventRestored      EventType = "restored"
+	EventRebooting     EventType = "rebooting"
+	EventRebooted      EventType = "rebooted"
+	EventShutdown      EventType = "shutdown"
+	EventDeleted       EventType = "deleted"
+	EventDeviceAdded   EventType = "device-added"
+	EventDeviceRemoved EventType = "device-removed"
+	EventActivated     EventType = "activated"
+	EventReset         EventType = "reset"
+	EventPanic         EventType = "panic"
+	// EventWatchdogReset is not emitted by the vmm, the sdk sends it with
+	// EventSourceDevice when the watchdog of the guest expired and the vmm
+	// resets the vm, see WithWatchdog.
+	EventWatchdogReset EventType = "watchdog-reset"
+)
+
+// Event is a lifecycle event emitted by the vmm on its event monitor.
+type Event struct {
+	// Time is when the event happened.
+	Time time.Time
+	// Elapsed is the time since the vmm was started.
+	Elapsed    time.Duration
+	Source     EventSource
+	Type       EventType
+	Properties map[string]string
+}
+
+type rawEvent struct {
+	Timestamp struct {
+		Secs  int64 `json:"secs"`
+		Nanos int64 `json:"nanos"`
+	} `json:"timestamp"`
+	Source     EventSource       `json:"source"`
+	Event      EventType         `json:"event"`
+	Properties map[string]string `json:"properties"`
+}
+
+// eventStates maps the events of the vm to the state the machine is in after
+// the event, these cover changes the guest makes on its own.
+var eventStates = map[EventType]State{
+	EventBooting:   StateBooting,
+	EventBooted:    StateRunning,
+	EventPaused:    StatePaused,
+	EventResumed:   StateRunning,
+	EventRebooting: StateBooting,
+	EventRebooted:  StateRunning,
+	EventShutdown:  StateShutdown,
+}
+
+// Events returns a channel that receives the events the vmm emits. The
+// channel is closed when the context is cancelled, the vmm exits or the
+// machine is deleted. Events
+// are dropped when the subscriber does not keep up.
+func (m *MachineImpl) Events(ctx context.Context) <-chan Event {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if m.eventsDone {
+		close(ch)
+		return ch
+	}
+
+	m.eventSubscribers[ch] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-m.exitCh:
+			// readEvents closes the channel once it has read the last events
+			return
+		}
+
+		m.eventsMu.Lock()
+		defer m.eventsMu.Unlock()
+
+		if _, ok := m.eventSubscribers[ch]; ok {
+			delete(m.eventSubscribers, ch)
+			close(ch)
+		}
+	}()
+
+	return ch
+}
+
+// closeEvents closes the channels of all event subscribers, no events are
+// delivered afterwards.
+func (m *MachineImpl) closeEvents() {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+
+	m.eventsDone = true
+	for ch := range m.eventSubscribers {
+		delete(m.eventSubscribers, ch)
+		close(ch)
+	}
+}
+
+// newEventMonitor creates the pipe the vmm writes its events to.
+func (m *MachineImpl) newEventMonitor(cmd []string) ([]string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not create event monitor: %w", err)
+	}
+
+	m.eventReader = r
+	m.eventWriter = w
+
+	return append(cmd, "--event-monitor", fmt.Sprintf("fd=%d", eventMonitorFD)), nil
+}
+
+// readEvents reads events from the event monitor until the vmm exits.
+func (m *MachineImpl) readEvents() {
+	defer func() {
+		m.eventReader.Close()
+		m.closeEvents()
+	}()
+
+	decoder := json.NewDecoder(m.eventReader)
+	for {
+		raw := rawEvent{}
+		err := decoder.Decode(&raw)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrClosed) {
+				m.logger.Printf("could not read event: %s", err)
+			}
+
+			return
+		}
+
+		elapsed := time.Duration(raw.Timestamp.Secs)*time.Second + time.Duration(raw.Timestamp.Nanos)
+		m.handleEvent(Event{
+			Time:       m.StartedAt().Add(elapsed),
+			Elapsed:    elapsed,
+			Source:     raw.Source,
+			Type:       raw.Event,
+			Properties: raw.Properties,
+		})
+	}
+}
+
+func (m *MachineImpl) handleEvent(event Event) {
+	if event.Source == EventSourceGuest && event.Type == EventPanic {
+		m.guestPanicked("reported by pvpanic")
+	}
+
+	if event.Source == EventSourceVM {
+		if state, ok := eventStates[event.Type]; ok {
+			m.setState(state, nil)
+		}
+	}
+
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+
+	for ch := range m.eventSubscribers {
+		select {
+		case ch <- event:
+		default:
+			m.logger.Printf("dropping %s event for slow subscriber", event.Type)
+		}
+	}
+}
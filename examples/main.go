@@ -4,9 +4,10 @@ import (
 	"context"
 	"log"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	sdk "github.com/jumppad-labs/cloudhypervisor-go-sdk"
-	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
 )
 
 func main() {
@@ -44,45 +45,27 @@ func main() {
 
 	_ = cloudinit
 
-	args := "root=/dev/vda1 ro console=tty1 console=ttyS0"
-	serial := "/tmp/serial"
-
-	// readonly := true
-
-	config := api.VmConfig{
-		Payload: api.PayloadConfig{
-			Kernel:    &kernel,
-			Initramfs: &initrd,
-			Cmdline:   &args,
-		},
-		Disks: &[]api.DiskConfig{
-			{
-				Path: disk,
-				// Readonly: &readonly,
-			},
-			// {
-			// 	Path: cloudinit,
-			// },
-		},
-		Net: &[]api.NetConfig{
-			{
-				Mac: &mac,
-			},
-		},
-		Cpus: &api.CpusConfig{
-			BootVcpus: 1,
-			MaxVcpus:  1,
-		},
-		Memory: &api.MemoryConfig{
-			Size: 1024 * 1000 * 1000, // 1GB
-		},
-		Serial: &api.ConsoleConfig{
-			Mode: "File",
-			File: &serial,
-		},
+	config, err := sdk.NewConfigBuilder().
+		WithKernel(kernel).
+		WithInitramfs(initrd).
+		WithCmdline("root=/dev/vda1 ro console=tty1 console=ttyS0").
+		WithCPUs(1, 1).
+		WithMemory("1GiB").
+		AddDisk(disk).
+		// AddReadonlyDisk(cloudinit).
+		AddNet(mac).
+		WithSerialFile("/tmp/serial").
+		Build()
+	if err != nil {
+		logger.Fatal(err)
 	}
 
-	machine, err := sdk.NewMachine(ctx, config, logger)
+	machine, err := sdk.NewMachine(ctx, config,
+		sdk.WithLogger(logger),
+		sdk.WithProcessGroup(),
+		sdk.WithParentDeathSignal(syscall.SIGKILL),
+		sdk.WithSignalHandling(30*time.Second),
+	)
 	if err != nil {
 		logger.Fatal(err)
 	}
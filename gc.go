@@ -0,0 +1,298 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultGCGracePeriod = 10 * time.Second
+	defaultGCMinAge      = time.Hour
+)
+
+type gcOptions struct {
+	gracePeriod time.Duration
+	minAge      time.Duration
+	registry    *Registry
+}
+
+// GCOption configures a garbage collection run.
+type GCOption func(*gcOptions)
+
+// WithGCGracePeriod sets how long an orphaned vmm gets to shut down after each
+// step before it is signalled more forcefully.
+func WithGCGracePeriod(d time.Duration) GCOption {
+	return func(o *gcOptions) {
+		o.gracePeriod = d
+	}
+}
+
+// WithGCMinAge sets how old half created runtime dirs and cloud-init staging
+// dirs must be before they are removed, so ones that are still being created
+// are left alone.
+func WithGCMinAge(d time.Duration) GCOption {
+	return func(o *gcOptions) {
+		o.minAge = d
+	}
+}
+
+// WithGCRegistry keeps the machines recorded in the registry whose vmm is still
+// running, even when the process that started them is gone, so they can be
+// attached to with Registry.Attach. Without it GC stops every vmm without a
+// live owner, so a program that wants to reattach to its machines after a
+// restart should pass its registry, or attach before running GC.
+func WithGCRegistry(r *Registry) GCOption {
+	return func(o *gcOptions) {
+		o.registry = r
+	}
+}
+
+// GCReport lists what a garbage collection run cleaned up.
+type GCReport struct {
+	// Stopped holds the pids of orphaned vmms that shut down on request.
+	Stopped []int
+	// Killed holds the pids of orphaned vmms that had to be signalled.
+	Killed []int
+	// Removed holds the runtime dirs and staging dirs that were removed.
+	Removed []string
+}
+
+// GC cleans up after machines whose owning process is gone, for example
+// because it crashed. It shuts down vmm processes started by the sdk that no
+// longer have an owner, first through their api, then with SIGTERM and
+// finally SIGKILL, and removes their runtime dirs together with everything in
+// them. Machines of processes that are still running are left alone, as are
+// registered machines when WithGCRegistry is used. Files outside the runtime
+// dirs, like the disk written by CreateCloudInitDisk, belong to the caller and
+// are never touched.
+func GC(ctx context.Context, opts ...GCOption) (*GCReport, error) {
+	options := gcOptions{
+		gracePeriod: defaultGCGracePeriod,
+		minAge:      defaultGCMinAge,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	report := &GCReport{}
+	base := runtimeBaseDir()
+
+	registered, err := registeredMachines(options.registry)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(base)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	orphans := map[string]bool{}
+	for _, entry := range entries {
+		dir := filepath.Join(base, entry.Name())
+		if !entry.IsDir() || hasLiveOwner(dir) || registered[dir] {
+			continue
+		}
+
+		// hidden dirs are runtime dirs and cloud-init staging dirs that are
+		// still being created, they are only left behind by a crash
+		if strings.HasPrefix(entry.Name(), ".") && !olderThan(dir, options.minAge) {
+			continue
+		}
+
+		orphans[dir] = true
+	}
+
+	// vmms whose runtime dir is orphaned or already gone
+	vmms, err := findVMMs(base)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := []error{}
+	for socket, pid := range vmms {
+		dir := filepath.Dir(socket)
+		if _, err := os.Stat(dir); err == nil && !orphans[dir] {
+			continue
+		}
+
+		if registered[dir] || registered[socket] {
+			continue
+		}
+
+		killed, err := stopOrphan(ctx, socket, pid, options.gracePeriod)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not stop vmm %d: %w", pid, err))
+			continue
+		}
+
+		if killed {
+			report.Killed = append(report.Killed, pid)
+		} else {
+			report.Stopped = append(report.Stopped, pid)
+		}
+	}
+
+	for dir := range orphans {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		report.Removed = append(report.Removed, dir)
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// olderThan reports whether path was last modified longer than age ago.
+func olderThan(path string, age time.Duration) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return time.Since(fi.ModTime()) >= age
+}
+
+// registeredMachines returns the runtime dirs and api sockets of the machines
+// in the registry whose vmm is still running.
+func registeredMachines(r *Registry) (map[string]bool, error) {
+	registered := map[string]bool{}
+	if r == nil {
+		return registered, nil
+	}
+
+	records, err := r.List()
+	if err != nil {
+		return nil, fmt.Errorf("could not read registry: %w", err)
+	}
+
+	for _, record := range records {
+		if !record.running() {
+			continue
+		}
+
+		if record.RuntimeDir != "" {
+			registered[record.RuntimeDir] = true
+		}
+
+		if record.SocketPath != "" {
+			registered[record.SocketPath] = true
+		}
+	}
+
+	return registered, nil
+}
+
+// hasLiveOwner reports whether the process that created the runtime dir is
+// still running.
+func hasLiveOwner(dir string) bool {
+	owner, err := readPIDFile(filepath.Join(dir, ownerFileName))
+	if err != nil {
+		return false
+	}
+
+	return processExists(owner)
+}
+
+// findVMMs returns the cloud-hypervisor processes whose api socket is inside
+// base, keyed by socket path.
+func findVMMs(base string) (map[string]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	vmms := map[string]int{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		cmdline, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+
+		args := strings.Split(string(bytes.TrimRight(cmdline, "\x00")), "\x00")
+		for i, arg := range args {
+			if arg != "--api-socket" || i+1 >= len(args) {
+				continue
+			}
+
+			socket := strings.TrimPrefix(args[i+1], "path=")
+			if strings.HasPrefix(socket, base+string(filepath.Separator)) {
+				vmms[socket] = pid
+			}
+		}
+	}
+
+	return vmms, nil
+}
+
+// stopOrphan shuts an orphaned vmm down, escalating to signals when it does
+// not exit within the grace period. It reports whether a signal was needed.
+func stopOrphan(ctx context.Context, socket string, pid int, grace time.Duration) (bool, error) {
+	client, err := newClient(socket)
+	if err == nil {
+		apiCtx, cancel := context.WithTimeout(ctx, grace)
+		resp, err := client.ShutdownVMM(apiCtx)
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+
+		if waitForProcessExit(ctx, pid, grace) {
+			return false, nil
+		}
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false, err
+	}
+
+	err = p.Signal(syscall.SIGTERM)
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return false, err
+	}
+
+	if waitForProcessExit(ctx, pid, grace) {
+		return true, nil
+	}
+
+	return true, killProcess(pid)
+}
+
+// waitForProcessExit waits up to timeout for a process that is not a child of
+// this process to exit.
+func waitForProcessExit(ctx context.Context, pid int, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if !processExists(pid) {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
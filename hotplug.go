@@ -0,0 +1,251 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+// hotplugStates are the states in which devices can be added and removed,
+// devices added before the vm is booted are cold plugged.
+var hotplugStates = []State{StateCreated, StateRunning, StatePaused}
+
+// AddDisk hotplugs a disk into the vm.
+func (m *MachineImpl) AddDisk(ctx context.Context, disk api.DiskConfig) (*api.PciDeviceInfo, error) {
+	err := m.requireState("add disk", hotplugStates...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.PutVmAddDisk(ctx, disk)
+	info, err := decodeDeviceInfo("add disk", resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	disk.Id = deviceID(info, disk.Id)
+	m.config.Disks = appendDevice(m.config.Disks, disk)
+
+	return info, nil
+}
+
+// AddNet hotplugs a network device into the vm.
+func (m *MachineImpl) AddNet(ctx context.Context, net api.NetConfig) (*api.PciDeviceInfo, error) {
+	err := m.requireState("add net", hotplugStates...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.PutVmAddNet(ctx, net)
+	info, err := decodeDeviceInfo("add net", resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	net.Id = deviceID(info, net.Id)
+	m.config.Net = appendDevice(m.config.Net, net)
+
+	return info, nil
+}
+
+// AddFs hotplugs a virtio-fs device into the vm.
+func (m *MachineImpl) AddFs(ctx context.Context, fs api.FsConfig) (*api.PciDeviceInfo, error) {
+	err := m.requireState("add fs", hotplugStates...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.PutVmAddFs(ctx, fs)
+	info, err := decodeDeviceInfo("add fs", resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	fs.Id = deviceID(info, fs.Id)
+	m.config.Fs = appendDevice(m.config.Fs, fs)
+
+	return info, nil
+}
+
+// AddPmem hotplugs a persistent memory device into the vm.
+func (m *MachineImpl) AddPmem(ctx context.Context, pmem api.PmemConfig) (*api.PciDeviceInfo, error) {
+	err := m.requireState("add pmem", hotplugStates...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.PutVmAddPmem(ctx, pmem)
+	info, err := decodeDeviceInfo("add pmem", resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	pmem.Id = deviceID(info, pmem.Id)
+	m.config.Pmem = appendDevice(m.config.Pmem, pmem)
+
+	return info, nil
+}
+
+// AddVsock hotplugs a vsock device into the vm, a vm can only have one.
+func (m *MachineImpl) AddVsock(ctx context.Context, vsock api.VsockConfig) (*api.PciDeviceInfo, error) {
+	err := m.requireState("add vsock", hotplugStates...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.PutVmAddVsock(ctx, vsock)
+	info, err := decodeDeviceInfo("add vsock", resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	vsock.Id = deviceID(info, vsock.Id)
+	m.config.Vsock = &vsock
+
+	return info, nil
+}
+
+// AddDevice hotplugs a vfio device into the vm.
+func (m *MachineImpl) AddDevice(ctx context.Context, device api.DeviceConfig) (*api.PciDeviceInfo, error) {
+	err := m.requireState("add device", hotplugStates...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.PutVmAddDevice(ctx, device)
+	info, err := decodeDeviceInfo("add device", resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	device.Id = deviceID(info, device.Id)
+	m.config.Devices = appendDevice(m.config.Devices, device)
+
+	return info, nil
+}
+
+// RemoveDevice unplugs the device with the given id from the vm.
+func (m *MachineImpl) RemoveDevice(ctx context.Context, id string) error {
+	err := m.requireState("remove device", hotplugStates...)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.PutVmRemoveDevice(ctx, api.VmRemoveDevice{
+		Id: &id,
+	})
+	err = checkResponse("remove device", resp, err, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	m.config.Disks = removeDevice(m.config.Disks, id, func(d api.DiskConfig) *string { return d.Id })
+	m.config.Net = removeDevice(m.config.Net, id, func(n api.NetConfig) *string { return n.Id })
+	m.config.Fs = removeDevice(m.config.Fs, id, func(f api.FsConfig) *string { return f.Id })
+	m.config.Pmem = removeDevice(m.config.Pmem, id, func(p api.PmemConfig) *string { return p.Id })
+	m.config.Devices = removeDevice(m.config.Devices, id, func(d api.DeviceConfig) *string { return d.Id })
+
+	if m.config.Vsock != nil && m.config.Vsock.Id != nil && *m.config.Vsock.Id == id {
+		m.config.Vsock = nil
+	}
+
+	return nil
+}
+
+// Config returns the config of the vm, including hotplugged devices.
+func (m *MachineImpl) Config() api.VmConfig {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	return m.config
+}
+
+func (m *MachineImpl) setConfig(config api.VmConfig) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	m.config = config
+}
+
+// decodeDeviceInfo reads the pci device info the vmm returns for a hotplugged
+// device. Devices added to a vm that has not been booted yet are cold plugged
+// and the vmm returns no info for them.
+func decodeDeviceInfo(operation string, resp *http.Response, err error) (*api.PciDeviceInfo, error) {
+	if err == nil && resp.StatusCode == http.StatusNoContent {
+		resp.Body.Close()
+		return nil, nil
+	}
+
+	err = checkResponse(operation, resp, err, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	info := &api.PciDeviceInfo{}
+	err = json.NewDecoder(resp.Body).Decode(info)
+	if err != nil {
+		return nil, fmt.Errorf("could not %s: %w", operation, err)
+	}
+
+	return info, nil
+}
+
+func deviceID(info *api.PciDeviceInfo, id *string) *string {
+	if info == nil {
+		return id
+	}
+
+	return &info.Id
+}
+
+func appendDevice[T any](devices *[]T, device T) *[]T {
+	if devices == nil {
+		return &[]T{device}
+	}
+
+	list := append(*devices, device)
+	return &list
+}
+
+func removeDevice[T any](devices *[]T, id string, getID func(T) *string) *[]T {
+	if devices == nil {
+		return nil
+	}
+
+	list := []T{}
+	for _, device := range *devices {
+		deviceID := getID(device)
+		if deviceID != nil && *deviceID == id {
+			continue
+		}
+
+		list = append(list, device)
+	}
+
+	return &list
+}
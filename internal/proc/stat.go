@@ -0,0 +1,108 @@
+// Package proc reads the state of processes from the /proc filesystem.
+package proc
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClockTicks is the USER_HZ the kernel reports process times in, which is 100
+// on all supported architectures.
+const ClockTicks = 100
+
+// Stat holds the fields of /proc/<pid>/stat the sdk uses.
+type Stat struct {
+	// CPU is the time the process spent in user and kernel mode.
+	CPU time.Duration
+	// RSS is the resident memory of the process in bytes.
+	RSS int64
+	// Start is the time the process was started, relative to the boot of the
+	// host.
+	Start time.Duration
+}
+
+// ReadStat reads /proc/<pid>/stat.
+func ReadStat(pid int) (*Stat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// the command name can contain spaces, the fields start after it
+	stat := string(data)
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return nil, fmt.Errorf("could not parse /proc/%d/stat", pid)
+	}
+
+	// fields[0] is the state, the third field of the file, so utime, stime,
+	// starttime and rss, the 14th, 15th, 22nd and 24th fields, are at 11, 12,
+	// 19 and 21
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("could not parse /proc/%d/stat", pid)
+	}
+
+	values := [4]int64{}
+	for i, index := range []int{11, 12, 19, 21} {
+		values[i], err = strconv.ParseInt(fields[index], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse /proc/%d/stat: %w", pid, err)
+		}
+	}
+
+	utime, stime, start, rss := values[0], values[1], values[2], values[3]
+
+	return &Stat{
+		CPU:   ticks(utime + stime),
+		RSS:   rss * int64(os.Getpagesize()),
+		Start: ticks(start),
+	}, nil
+}
+
+// StartTime returns the time a process was started.
+func StartTime(pid int) (time.Time, error) {
+	stat, err := ReadStat(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	boot, err := BootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return boot.Add(stat.Start), nil
+}
+
+// BootTime reads the boot time of the host from the btime line of
+// /proc/stat.
+func BootTime() (time.Time, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := strings.CutPrefix(line, "btime ")
+		if !ok {
+			continue
+		}
+
+		secs, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return time.Unix(secs, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("could not find btime in /proc/stat")
+}
+
+func ticks(n int64) time.Duration {
+	return time.Duration(n) * time.Second / ClockTicks
+}
@@ -0,0 +1,83 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// WithProcessGroup starts the vmm in its own process group, so signals sent to
+// the process group of the program, e.g. by pressing ctrl-c in a terminal, do
+// not reach the vmm and the sdk can shut the guest down instead. It has no
+// effect on platforms without process groups.
+func WithProcessGroup() Option {
+	return func(m *MachineImpl) error {
+		m.setpgid = true
+		return nil
+	}
+}
+
+// WithSignalHandling shuts the machine down when the program receives SIGINT
+// or SIGTERM. The guest gets an acpi power button event and the vmm is killed
+// when the guest has not shut down within the deadline, or when a second
+// signal arrives. The program itself keeps running, Wait returns once the vmm
+// has exited.
+func WithSignalHandling(deadline time.Duration) Option {
+	return func(m *MachineImpl) error {
+		if deadline <= 0 {
+			return fmt.Errorf("signal deadline must be positive: %s", deadline)
+		}
+
+		m.signalDeadline = deadline
+		return nil
+	}
+}
+
+// handleSignals shuts the machine down on SIGINT or SIGTERM, until the vmm
+// exits.
+func (m *MachineImpl) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case <-m.exitCh:
+		return
+	case sig := <-signals:
+		m.logger.Printf("received %s, shutting down machine %s", sig, m.id)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.signalDeadline)
+	defer cancel()
+
+	err := m.PowerButton(ctx)
+	if err != nil {
+		// the guest can not react to the power button, e.g. because it is
+		// paused or was never booted
+		m.logger.Printf("could not press power button: %s", err)
+
+		err = stopMachine(ctx, m)
+		if err != nil {
+			m.logger.Printf("could not stop machine %s: %s", m.id, err)
+		}
+
+		return
+	}
+
+	select {
+	case <-m.exitCh:
+		return
+	case <-ctx.Done():
+		m.logger.Printf("machine %s did not shut down within %s, killing vmm", m.id, m.signalDeadline)
+	case sig := <-signals:
+		m.logger.Printf("received %s again, killing vmm", sig)
+	}
+
+	err = killProcess(m.vmmPID())
+	if err != nil {
+		m.logger.Printf("could not kill vmm: %s", err)
+	}
+}
@@ -0,0 +1,23 @@
+package sdk
+
+import (
+	"syscall"
+)
+
+// WithParentDeathSignal makes the kernel send sig to the vmm when the program
+// dies, so a crashed program does not leave the vmm running. The signal is
+// tied to the os thread that started the vmm, which the go runtime keeps
+// around unless it was locked by a goroutine that exited without unlocking.
+func WithParentDeathSignal(sig syscall.Signal) Option {
+	return func(m *MachineImpl) error {
+		m.pdeathsig = sig
+		return nil
+	}
+}
+
+func (m *MachineImpl) sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid:   m.setpgid,
+		Pdeathsig: m.pdeathsig,
+	}
+}
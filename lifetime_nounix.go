@@ -0,0 +1,11 @@
+//go:build !unix
+
+package sdk
+
+import (
+	"syscall"
+)
+
+func (m *MachineImpl) sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{}
+}
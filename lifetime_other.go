@@ -0,0 +1,15 @@
+//go:build !linux
+
+package sdk
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// WithParentDeathSignal is only supported on linux.
+func WithParentDeathSignal(sig syscall.Signal) Option {
+	return func(m *MachineImpl) error {
+		return fmt.Errorf("parent death signal is not supported on this platform")
+	}
+}
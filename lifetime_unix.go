@@ -0,0 +1,13 @@
+//go:build unix && !linux
+
+package sdk
+
+import (
+	"syscall"
+)
+
+func (m *MachineImpl) sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid: m.setpgid,
+	}
+}
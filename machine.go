@@ -2,6 +2,7 @@ package sdk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,16 +11,18 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
 )
 
 // TODO: set up networking
-// TODO: handle signals
 // TODO: set up vm/vmm logging -> stderr/stdout?
-// TODO: set up vm/vmm metrics -> get metrics from process?
+// TODO: set up vmm metrics -> get metrics from process?
 // TODO: create overlayfs disk
 
 /*
@@ -38,65 +41,138 @@ https://github.com/cloud-hypervisor/cloud-hypervisor/blob/main/docs/custom-image
 type Option func(*MachineImpl) error
 
 const (
-	defaultSocket  = "/tmp/cloud-hypervisor.sock"
-	defaultURL     = "http://localhost/api/v1/"
-	virtiofsSocket = "/tmp/virtiofs.sock"
+	defaultURL         = "http://localhost/api/v1/"
+	defaultBinary      = "cloud-hypervisor"
+	defaultVerbosity   = 1
+	defaultBootTimeout = 10 * time.Second
 )
 
 type Machine interface {
+	ID() string
 	PID() (int, error)
+	StartedAt() time.Time
+	State() State
+	Subscribe(ctx context.Context) <-chan StateEvent
+	Events(ctx context.Context) <-chan Event
 	Start(ctx context.Context) error
 	Pause(ctx context.Context) error
 	Resume(ctx context.Context) error
-	Snapshot(ctx context.Context, destination string) error
-	Restore(ctx context.Context, source string) error
+	Snapshot(ctx context.Context, destination string, opts ...SnapshotOption) error
 	Reboot(ctx context.Context) error
 	PowerButton(ctx context.Context) error
 	Shutdown(ctx context.Context) error
+	Stop(ctx context.Context, opts StopOptions) (StopStage, error)
+	Delete(ctx context.Context) error
 	Wait(ctx context.Context) error
 	Info(ctx context.Context) (*api.VmInfo, error)
+	Config() api.VmConfig
+	CommandLine() string
+	AddDisk(ctx context.Context, disk api.DiskConfig) (*api.PciDeviceInfo, error)
+	AddNet(ctx context.Context, net api.NetConfig) (*api.PciDeviceInfo, error)
+	AddFs(ctx context.Context, fs api.FsConfig) (*api.PciDeviceInfo, error)
+	AddPmem(ctx context.Context, pmem api.PmemConfig) (*api.PciDeviceInfo, error)
+	AddVsock(ctx context.Context, vsock api.VsockConfig) (*api.PciDeviceInfo, error)
+	AddDevice(ctx context.Context, device api.DeviceConfig) (*api.PciDeviceInfo, error)
+	RemoveDevice(ctx context.Context, id string) error
+	Resize(ctx context.Context, request ResizeRequest) error
+	ResizeZone(ctx context.Context, id string, size int64) error
+	Counters(ctx context.Context) (*Counters, error)
+	Coredump(ctx context.Context, path string) error
+	InjectNMI(ctx context.Context) error
 }
 
 type MachineImpl struct {
-	context   context.Context
-	client    *api.Client
-	cmd       *exec.Cmd
-	config    api.VmConfig
-	startOnce sync.Once
-	exitCh    chan struct{}
-	fatalErr  error
-	logger    *log.Logger
+	id                string
+	runtimeDir        string
+	keepRuntimeDir    bool
+	createdRuntimeDir bool
+	apiReady          atomic.Bool
+	socketPath        string
+	binary            string
+	args              []string
+	verbosity         int
+	stdout            io.Writer
+	stderr            io.Writer
+	stdin             io.Reader
+	bootTimeout       time.Duration
+	snapshot          string
+	restoreOpts       []RestoreOption
+	context           context.Context
+	client            *api.Client
+	cmd               *exec.Cmd
+	pid               int // guarded by stateMu
+	config            api.VmConfig
+	configMu          sync.Mutex
+	startOnce         sync.Once
+	exitCh            chan struct{}
+	exitOnce          sync.Once
+	startedAt         time.Time // guarded by stateMu
+	state             State
+	stateMu           sync.Mutex
+	subscribers       map[chan StateEvent]struct{}
+	eventReader       *os.File
+	eventWriter       *os.File
+	eventsMu          sync.Mutex
+	eventsDone        bool
+	eventSubscribers  map[chan Event]struct{}
+	fatalErr          error
+	watchSerial       bool
+	coredumpDir       string
+	panicCh           chan struct{}
+	panicOnce         sync.Once
+	panicErr          error
+	setpgid           bool
+	pdeathsig         syscall.Signal
+	signalDeadline    time.Duration
+	shares            []share
+	configArgs        bool
+	logger            *log.Logger
 }
 
-func newVMMCommand(socket string, logger *log.Logger) (*exec.Cmd, error) {
-	path, err := exec.LookPath("cloud-hypervisor")
+func (m *MachineImpl) newVMMCommand() (*exec.Cmd, error) {
+	path, err := exec.LookPath(m.binary)
 	if err != nil {
 		return nil, err
 	}
 
 	args := []string{
-		"--api-socket", socket,
+		"--api-socket", m.socketPath,
 	}
 
-	// if logger.GetLevel() == log.InfoLevel {
-	args = append(args, "-v")
-	// } else if logger.GetLevel() == log.DebugLevel {
-	// 	args = append(args, "-vv")
-	// }
+	if m.verbosity > 0 {
+		args = append(args, "-"+strings.Repeat("v", m.verbosity))
+	}
+
+	args, err = m.newEventMonitor(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.configArgs {
+		args = append(args, ConfigArgs(m.config)...)
+	}
+
+	args = append(args, m.args...)
 
 	cmd := exec.Command(path, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	cmd.Stdout = m.stdout
+	cmd.Stderr = m.stderr
+	cmd.Stdin = m.stdin
+
+	if m.config.Watchdog != nil && *m.config.Watchdog {
+		cmd.Stderr = &watchdogWriter{w: m.stderr, reset: m.watchdogReset}
+	}
+	cmd.ExtraFiles = []*os.File{m.eventWriter}
+	cmd.SysProcAttr = m.sysProcAttr()
 
 	return cmd, nil
 }
 
-func newClient() (*api.Client, error) {
+func newClient(socket string) (*api.Client, error) {
 	unixClient := &http.Client{
 		Transport: &http.Transport{
 			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial("unix", defaultSocket)
+				return net.Dial("unix", socket)
 			},
 		},
 	}
@@ -109,34 +185,95 @@ func newClient() (*api.Client, error) {
 	return client, nil
 }
 
-func NewMachine(ctx context.Context, config api.VmConfig, logger *log.Logger) (Machine, error) {
-	cmd, err := newVMMCommand(defaultSocket, logger)
+func NewMachine(ctx context.Context, config api.VmConfig, opts ...Option) (Machine, error) {
+	m, err := newMachine(ctx, config, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// validate once the runtime paths are filled in
+	err = m.config.Validate()
+	if err != nil {
+		return nil, errors.Join(err, m.release())
+	}
+
+	// TODO: convert config to vm config
+
+	return m, nil
+}
+
+func newMachine(ctx context.Context, config api.VmConfig, opts ...Option) (*MachineImpl, error) {
+	m, err := defaultMachine(ctx, config, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := newClient()
+	err = m.createRuntimeDir()
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: validate config
-	// err = config.Validate()
+	m.setRuntimePaths()
 
-	// TODO: convert config to vm config
+	m.cmd, err = m.newVMMCommand()
+	if err != nil {
+		return nil, errors.Join(err, m.release())
+	}
+
+	m.client, err = newClient(m.SocketPath())
+	if err != nil {
+		return nil, errors.Join(err, m.release())
+	}
 
-	return &MachineImpl{
-		context: ctx,
-		client:  client,
-		cmd:     cmd,
-		config:  config,
-		exitCh:  make(chan struct{}),
-		logger:  logger,
-	}, nil
+	return m, nil
+}
+
+// defaultMachine creates a machine with the defaults and the options applied,
+// without touching the host.
+func defaultMachine(ctx context.Context, config api.VmConfig, opts ...Option) (*MachineImpl, error) {
+	id, err := newMachineID()
+	if err != nil {
+		return nil, err
+	}
+
+	// the runtime paths and options write through the pointers of the config,
+	// copy it so machines created from the same config do not share them
+	config, err = copyConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not copy config: %w", err)
+	}
+
+	m := &MachineImpl{
+		id:               id,
+		binary:           defaultBinary,
+		verbosity:        defaultVerbosity,
+		stdout:           os.Stdout,
+		stderr:           os.Stderr,
+		stdin:            os.Stdin,
+		bootTimeout:      defaultBootTimeout,
+		context:          ctx,
+		config:           config,
+		exitCh:           make(chan struct{}),
+		panicCh:          make(chan struct{}),
+		state:            StateNotStarted,
+		subscribers:      map[chan StateEvent]struct{}{},
+		eventSubscribers: map[chan Event]struct{}{},
+		logger:           log.Default(),
+	}
+
+	for _, opt := range opts {
+		err := opt(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
 }
 
 func (m *MachineImpl) PID() (int, error) {
-	if m.cmd == nil || m.cmd.Process == nil {
+	pid := m.vmmPID()
+	if pid == 0 {
 		return 0, fmt.Errorf("machine is not running")
 	}
 
@@ -145,10 +282,87 @@ func (m *MachineImpl) PID() (int, error) {
 		return 0, fmt.Errorf("machine process has exited")
 	default:
 	}
-	return m.cmd.Process.Pid, nil
+	return pid, nil
+}
+
+// StartedAt returns the time the vmm process was started.
+func (m *MachineImpl) StartedAt() time.Time {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	return m.startedAt
+}
+
+// vmmPID returns the pid of the vmm, also after it has exited, or 0 when it
+// has not been started.
+func (m *MachineImpl) vmmPID() int {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	return m.pid
+}
+
+// setProcess records the pid and start time of the vmm.
+func (m *MachineImpl) setProcess(pid int, startedAt time.Time) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	m.pid = pid
+	m.startedAt = startedAt
 }
 
 func (m *MachineImpl) Start(ctx context.Context) error {
+	if m.configArgs {
+		return m.startFromArgs()
+	}
+
+	err := m.launchVMM()
+	if err != nil {
+		return err
+	}
+
+	err = m.startShares()
+	if err != nil {
+		m.logger.Println(err)
+		m.exit(err)
+
+		return err
+	}
+
+	if m.snapshot != "" {
+		err = m.restoreVM()
+		if err != nil {
+			m.logger.Println(err)
+			m.exit(err)
+
+			return err
+		}
+
+		return nil
+	}
+
+	err = m.createVM()
+	if err != nil {
+		m.logger.Println(err)
+		m.exit(err)
+
+		return err
+	}
+
+	err = m.bootVM()
+	if err != nil {
+		m.logger.Println(err)
+		m.exit(err)
+
+		return err
+	}
+
+	return nil
+}
+
+// launchVMM starts the vmm process and waits for its api to come up, without
+// creating a vm.
+func (m *MachineImpl) launchVMM() error {
 	alreadyStarted := true
 	m.startOnce.Do(func() {
 		m.logger.Println("marking machine as started")
@@ -158,67 +372,90 @@ func (m *MachineImpl) Start(ctx context.Context) error {
 		return fmt.Errorf("machine already started")
 	}
 
+	m.setState(StateVMMStarting, nil)
+
 	// start vmm
 	err := m.startVMM()
 	if err != nil {
+		m.exit(err)
 		return err
 	}
 
-	errCh := make(chan error)
+	m.setProcess(m.cmd.Process.Pid, time.Now())
+
+	err = m.writePIDFile()
+	if err != nil {
+		m.logger.Println(err)
+	}
+
+	go m.readEvents()
+
+	if m.watchSerial {
+		go m.watchSerialOutput()
+	}
+
+	if m.signalDeadline > 0 {
+		go m.handleSignals()
+	}
+
 	go func() {
-		waitErr := m.cmd.Wait()
-		if waitErr != nil {
-			errCh <- waitErr
+		err := m.cmd.Wait()
+
+		// a vmm that exits cleanly before its api is up still failed to start
+		if err == nil && !m.apiReady.Load() {
+			err = ErrVMMExitedEarly
 		}
 
-		close(errCh)
+		m.exit(err)
 	}()
 
 	// m.StartVirtioFS()
 
 	// wait for vmm to start
-	err = m.waitForSocket(10*time.Second, errCh)
+	err = m.waitForSocket(m.bootTimeout)
 	if err != nil {
 		m.logger.Println(err)
-		m.fatalErr = err
-		close(m.exitCh)
+		m.exit(err)
 
 		return err
 	}
 
 	m.logger.Println("vmm is ready")
 
-	err = m.createVM()
-	if err != nil {
-		m.logger.Println(err)
-		m.fatalErr = err
-		close(m.exitCh)
-
-		return err
-	}
+	return nil
+}
 
-	err = m.bootVM()
-	if err != nil {
-		m.logger.Println(err)
+// exit marks the machine as exited, only the first error is kept.
+func (m *MachineImpl) exit(err error) {
+	m.exitOnce.Do(func() {
 		m.fatalErr = err
-		close(m.exitCh)
 
-		return err
-	}
+		if err != nil {
+			m.setState(StateFailed, err)
+		} else {
+			m.setState(StateExited, nil)
+		}
 
-	return nil
+		close(m.exitCh)
+	})
 }
 
 func (m *MachineImpl) startVMM() error {
 	err := m.cmd.Start()
+
+	// only the vmm writes to the event monitor, closing our end lets the
+	// reader see the end of the stream when the vmm exits
+	m.eventWriter.Close()
+
 	if err != nil {
+		m.eventReader.Close()
 		return err
 	}
 
 	return nil
 }
 
-func (m *MachineImpl) waitForSocket(timeout time.Duration, exitCh chan error) error {
+func (m *MachineImpl) waitForSocket(timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 
 	ticker := time.NewTicker(10 * time.Millisecond)
@@ -232,10 +469,14 @@ func (m *MachineImpl) waitForSocket(timeout time.Duration, exitCh chan error) er
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case err := <-exitCh:
-			return err
+		case <-m.exitCh:
+			if m.fatalErr != nil {
+				return m.fatalErr
+			}
+
+			return ErrVMMExitedEarly
 		case <-ticker.C:
-			if _, err := os.Stat(defaultSocket); err != nil {
+			if _, err := os.Stat(m.SocketPath()); err != nil {
 				continue
 			}
 
@@ -243,6 +484,7 @@ func (m *MachineImpl) waitForSocket(timeout time.Duration, exitCh chan error) er
 				continue
 			}
 
+			m.apiReady.Store(true)
 			return nil
 		}
 	}
@@ -250,191 +492,204 @@ func (m *MachineImpl) waitForSocket(timeout time.Duration, exitCh chan error) er
 
 func (m *MachineImpl) createVM() error {
 	resp, err := m.client.CreateVM(m.context, m.config)
+	err = checkResponse("create vm", resp, err, http.StatusNoContent)
 	if err != nil {
 		return err
 	}
 
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("could not create vm: %s", string(body))
-	}
+	m.setState(StateCreated, nil)
 
 	return nil
 }
 
 func (m *MachineImpl) bootVM() error {
+	m.setState(StateBooting, nil)
+
 	resp, err := m.client.BootVM(m.context)
+	err = checkResponse("boot vm", resp, err, http.StatusNoContent)
 	if err != nil {
 		return err
 	}
 
-	// TODO: check for 204, 404
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("could not boot vm: %s", string(body))
-	}
+	m.setState(StateRunning, nil)
 
 	return nil
 }
 
 func (m *MachineImpl) Pause(ctx context.Context) error {
-	_, err := m.client.PauseVM(m.context)
+	err := m.requireState("pause vm", StateRunning)
 	if err != nil {
 		return err
 	}
 
-	// TODO: check for 204, 404, 405
-	return nil
-}
-
-func (m *MachineImpl) Resume(ctx context.Context) error {
-	_, err := m.client.ResumeVM(m.context)
+	resp, err := m.client.PauseVM(ctx)
+	err = checkResponse("pause vm", resp, err, http.StatusNoContent)
 	if err != nil {
 		return err
 	}
 
-	// TODO: check for 204, 404, 405
+	m.setState(StatePaused, nil)
+
 	return nil
 }
 
-func (m *MachineImpl) Snapshot(ctx context.Context, destination string) error {
-	config := api.VmSnapshotConfig{}
-	_, err := m.client.PutVmSnapshot(m.context, config)
+func (m *MachineImpl) Resume(ctx context.Context) error {
+	err := m.requireState("resume vm", StatePaused)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func (m *MachineImpl) Restore(ctx context.Context, source string) error {
-	config := api.RestoreConfig{}
-	_, err := m.client.PutVmRestore(m.context, config)
+	resp, err := m.client.ResumeVM(ctx)
+	err = checkResponse("resume vm", resp, err, http.StatusNoContent)
 	if err != nil {
 		return err
 	}
 
+	m.setState(StateRunning, nil)
+
 	return nil
 }
 
 func (m *MachineImpl) Reboot(ctx context.Context) error {
-	_, err := m.client.RebootVM(m.context)
+	err := m.requireState("reboot vm", StateRunning, StatePaused)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.RebootVM(ctx)
+	err = checkResponse("reboot vm", resp, err, http.StatusNoContent)
 	if err != nil {
 		return err
 	}
 
-	// TODO: check for 204, 404, 405
+	m.setState(StateBooting, nil)
+	m.setState(StateRunning, nil)
+
 	return nil
 }
 
 func (m *MachineImpl) PowerButton(ctx context.Context) error {
-	_, err := m.client.PowerButtonVM(m.context)
+	err := m.requireState("power button vm", StateRunning)
 	if err != nil {
 		return err
 	}
 
-	// TODO: check for 204, 404, 405
-
-	return nil
+	resp, err := m.client.PowerButtonVM(ctx)
+	return checkResponse("power button vm", resp, err, http.StatusNoContent)
 }
 
 func (m *MachineImpl) Shutdown(ctx context.Context) error {
-	resp, err := m.client.ShutdownVM(m.context)
+	previous := m.State()
+
+	err := m.requireState("shutdown vm", StateCreated, StateRunning, StatePaused, StateShutdown)
 	if err != nil {
 		return err
 	}
 
-	// TODO: check for 204, 404, 405
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("could not shutdown vm: %s", string(body))
-	}
+	m.setState(StateShuttingDown, nil)
 
-	resp, err = m.client.ShutdownVMM(m.context)
+	resp, err := m.client.ShutdownVM(ctx)
+	err = checkResponse("shutdown vm", resp, err, http.StatusNoContent)
 	if err != nil {
+		m.setState(previous, nil)
 		return err
 	}
 
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("could not shutdown vmm: %s", string(body))
-	}
+	m.setState(StateShutdown, nil)
 
-	return nil
+	resp, err = m.client.ShutdownVMM(ctx)
+	return checkResponse("shutdown vmm", resp, err, http.StatusNoContent)
 }
 
-func (m *MachineImpl) Delete() error {
-	resp, err := m.client.DeleteVM(m.context)
-	if err != nil {
-		return err
+// Delete stops the vmm if it is still running and releases the resources of
+// the machine, the runtime dir is removed if the sdk created it. It does not
+// need the api, so it also cleans up after the vmm has exited.
+func (m *MachineImpl) Delete(ctx context.Context) error {
+	if m.vmmPID() != 0 && !m.exited() {
+		err := stopMachine(ctx, m)
+		if err != nil {
+			return fmt.Errorf("could not delete machine: %w", err)
+		}
+
+		m.waitExited(ctx, killTimeout)
 	}
 
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("could not delete vm: %s", string(body))
+	// a machine that was never started has no vmm to wait for, it exits here
+	// so its subscribers are released
+	if m.vmmPID() == 0 {
+		m.exit(nil)
+		m.closeEvents()
 	}
 
-	return nil
+	return m.release()
 }
 
-func (m *MachineImpl) ping() error {
-	resp, err := m.client.GetVmmPing(m.context)
-	if err != nil {
-		return err
+// release closes the event monitor and removes the runtime dir, closing the
+// pipe a second time is harmless.
+func (m *MachineImpl) release() error {
+	if m.eventWriter != nil {
+		m.eventWriter.Close()
+		m.eventReader.Close()
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("could not ping vmm: %s", string(body))
+	return m.removeRuntimeDir()
+}
+
+func (m *MachineImpl) ping() error {
+	_, err := m.vmmPing(m.context)
+	return err
+}
+
+func (m *MachineImpl) vmmPing(ctx context.Context) (*api.VmmPingResponse, error) {
+	resp, err := m.client.GetVmmPing(ctx)
+	err = checkResponse("ping vmm", resp, err, http.StatusOK)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = api.ParseGetVmmPingResponse(resp)
+	ping, err := api.ParseGetVmmPingResponse(resp)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return ping.JSON200, nil
 }
 
+// Wait blocks until the vmm exits or the guest panics. It returns
+// ErrGuestPanicked when the guest panicked.
 func (m *MachineImpl) Wait(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
+	case <-m.panicCh:
+		return m.panicErr
 	case <-m.exitCh:
+		select {
+		case <-m.panicCh:
+			return m.panicErr
+		default:
+		}
+
 		return m.fatalErr
 	}
 }
 
 func (m *MachineImpl) Version(ctx context.Context) (string, error) {
-	resp, err := m.client.GetVmmPing(ctx)
+	info, err := m.vmmPing(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("could not get vmm info: %s", string(body))
-	}
-
-	info, err := api.ParseGetVmmPingResponse(resp)
-	if err != nil {
-		return "", err
-	}
-
-	return info.JSON200.Version, nil
+	return info.Version, nil
 }
 
 func (m *MachineImpl) Info(ctx context.Context) (*api.VmInfo, error) {
 	resp, err := m.client.GetVmInfo(ctx)
+	err = checkResponse("get vm info", resp, err, http.StatusOK)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("could not get vm info: %s", string(body))
-	}
-
 	info, err := api.ParseGetVmInfoResponse(resp)
 	if err != nil {
 		return nil, err
@@ -476,18 +731,16 @@ func (m *MachineImpl) StartVirtioFS() {
 
 	virtioCh := make(chan error)
 	go func() {
-		virtioCmd, err := newVirtioFSCommand(virtiofsSocket, directories, 4)
+		virtioCmd, err := newVirtioFSCommand(m.runtimePath(virtiofsName), directories, 4)
 		if err != nil {
 			m.logger.Println(err)
-			m.fatalErr = err
-			close(m.exitCh)
+			m.exit(err)
 		}
 
 		err = virtioCmd.Start()
 		if err != nil {
 			m.logger.Println(err)
-			m.fatalErr = err
-			close(m.exitCh)
+			m.exit(err)
 		}
 		virtioCh <- virtioCmd.Wait()
 	}()
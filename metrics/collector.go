@@ -0,0 +1,256 @@
+// Package metrics exports metrics of machines created with the sdk in the
+// prometheus format.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	sdk "github.com/jumppad-labs/cloudhypervisor-go-sdk"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/internal/proc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace      = "cloudhypervisor"
+	defaultTimeout = 5 * time.Second
+)
+
+var states = []api.VmInfoState{
+	api.Created,
+	api.Running,
+	api.Paused,
+	api.Shutdown,
+}
+
+var (
+	upDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "up"),
+		"Whether the vmm of the machine responds to api requests.",
+		[]string{"id"}, nil,
+	)
+	stateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "state"),
+		"The state of the vm, 1 for the current state.",
+		[]string{"id", "state"}, nil,
+	)
+	vcpusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "vcpus"),
+		"Number of vcpus of the vm.",
+		[]string{"id"}, nil,
+	)
+	maxVcpusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "max_vcpus"),
+		"Maximum number of vcpus the vm can be resized to.",
+		[]string{"id"}, nil,
+	)
+	memoryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "memory_bytes"),
+		"Memory available to the vm, excluding the balloon.",
+		[]string{"id"}, nil,
+	)
+	uptimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "uptime_seconds"),
+		"Seconds since the vmm of the machine was started.",
+		[]string{"id"}, nil,
+	)
+	diskReadBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "disk_read_bytes_total"),
+		"Bytes read from the disk.",
+		[]string{"id", "device"}, nil,
+	)
+	diskWriteBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "disk_write_bytes_total"),
+		"Bytes written to the disk.",
+		[]string{"id", "device"}, nil,
+	)
+	diskReadOpsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "disk_read_ops_total"),
+		"Read operations on the disk.",
+		[]string{"id", "device"}, nil,
+	)
+	diskWriteOpsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "disk_write_ops_total"),
+		"Write operations on the disk.",
+		[]string{"id", "device"}, nil,
+	)
+	netRxBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "net_rx_bytes_total"),
+		"Bytes received by the network device.",
+		[]string{"id", "device"}, nil,
+	)
+	netTxBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "net_tx_bytes_total"),
+		"Bytes sent by the network device.",
+		[]string{"id", "device"}, nil,
+	)
+	netRxPacketsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "net_rx_packets_total"),
+		"Packets received by the network device.",
+		[]string{"id", "device"}, nil,
+	)
+	netTxPacketsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vm", "net_tx_packets_total"),
+		"Packets sent by the network device.",
+		[]string{"id", "device"}, nil,
+	)
+	vmmRSSDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vmm", "resident_memory_bytes"),
+		"Resident memory of the vmm process.",
+		[]string{"id"}, nil,
+	)
+	vmmCPUDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vmm", "cpu_seconds_total"),
+		"User and system cpu time spent by the vmm process.",
+		[]string{"id"}, nil,
+	)
+)
+
+// Collector is a prometheus.Collector that exposes the metrics of a set of
+// machines, labeled by machine id.
+type Collector struct {
+	mu       sync.Mutex
+	machines map[string]sdk.Machine
+	timeout  time.Duration
+}
+
+// NewCollector creates a collector for the given machines.
+func NewCollector(machines ...sdk.Machine) *Collector {
+	c := &Collector{
+		machines: map[string]sdk.Machine{},
+		timeout:  defaultTimeout,
+	}
+
+	for _, m := range machines {
+		c.Add(m)
+	}
+
+	return c
+}
+
+// Add starts collecting metrics for the machine.
+func (c *Collector) Add(m sdk.Machine) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.machines[m.ID()] = m
+}
+
+// Remove stops collecting metrics for the machine with the given id.
+func (c *Collector) Remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.machines, id)
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		upDesc, stateDesc, vcpusDesc, maxVcpusDesc, memoryDesc, uptimeDesc,
+		diskReadBytesDesc, diskWriteBytesDesc, diskReadOpsDesc, diskWriteOpsDesc,
+		netRxBytesDesc, netTxBytesDesc, netRxPacketsDesc, netTxPacketsDesc,
+		vmmRSSDesc, vmmCPUDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	machines := make([]sdk.Machine, 0, len(c.machines))
+	for _, m := range c.machines {
+		machines = append(machines, m)
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	for _, m := range machines {
+		wg.Add(1)
+		go func(m sdk.Machine) {
+			defer wg.Done()
+			collectMachine(ctx, m, ch)
+		}(m)
+	}
+	wg.Wait()
+}
+
+func collectMachine(ctx context.Context, m sdk.Machine, ch chan<- prometheus.Metric) {
+	id := m.ID()
+
+	info, err := m.Info(ctx)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 0, id)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1, id)
+
+	for _, state := range states {
+		value := 0.0
+		if info.State == state {
+			value = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, value, id, string(state))
+	}
+
+	if info.Config.Cpus != nil {
+		ch <- prometheus.MustNewConstMetric(vcpusDesc, prometheus.GaugeValue, float64(info.Config.Cpus.BootVcpus), id)
+		ch <- prometheus.MustNewConstMetric(maxVcpusDesc, prometheus.GaugeValue, float64(info.Config.Cpus.MaxVcpus), id)
+	}
+
+	if info.MemoryActualSize != nil {
+		ch <- prometheus.MustNewConstMetric(memoryDesc, prometheus.GaugeValue, float64(*info.MemoryActualSize), id)
+	}
+
+	if started := m.StartedAt(); !started.IsZero() {
+		ch <- prometheus.MustNewConstMetric(uptimeDesc, prometheus.GaugeValue, time.Since(started).Seconds(), id)
+	}
+
+	counters, err := m.Counters(ctx)
+	if err == nil {
+		for device, disk := range counters.Disks {
+			ch <- prometheus.MustNewConstMetric(diskReadBytesDesc, prometheus.CounterValue, float64(disk.ReadBytes), id, device)
+			ch <- prometheus.MustNewConstMetric(diskWriteBytesDesc, prometheus.CounterValue, float64(disk.WriteBytes), id, device)
+			ch <- prometheus.MustNewConstMetric(diskReadOpsDesc, prometheus.CounterValue, float64(disk.ReadOps), id, device)
+			ch <- prometheus.MustNewConstMetric(diskWriteOpsDesc, prometheus.CounterValue, float64(disk.WriteOps), id, device)
+		}
+
+		for device, net := range counters.Nets {
+			ch <- prometheus.MustNewConstMetric(netRxBytesDesc, prometheus.CounterValue, float64(net.RxBytes), id, device)
+			ch <- prometheus.MustNewConstMetric(netTxBytesDesc, prometheus.CounterValue, float64(net.TxBytes), id, device)
+			ch <- prometheus.MustNewConstMetric(netRxPacketsDesc, prometheus.CounterValue, float64(net.RxPackets), id, device)
+			ch <- prometheus.MustNewConstMetric(netTxPacketsDesc, prometheus.CounterValue, float64(net.TxPackets), id, device)
+		}
+	}
+
+	pid, err := m.PID()
+	if err != nil {
+		return
+	}
+
+	stat, err := proc.ReadStat(pid)
+	if err != nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(vmmRSSDesc, prometheus.GaugeValue, float64(stat.RSS), id)
+	ch <- prometheus.MustNewConstMetric(vmmCPUDesc, prometheus.CounterValue, stat.CPU.Seconds(), id)
+}
+
+// Handler returns an http.Handler that serves the metrics of the collector.
+func Handler(c *Collector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
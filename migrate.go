@@ -0,0 +1,215 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+const (
+	migrationSocketName = "migration.sock"
+	unixScheme          = "unix:"
+)
+
+// MigrationPhase is a step of a live migration.
+type MigrationPhase string
+
+const (
+	MigrationPreparing     MigrationPhase = "Preparing"
+	MigrationReceiverReady MigrationPhase = "ReceiverReady"
+	MigrationSending       MigrationPhase = "Sending"
+	MigrationCompleted     MigrationPhase = "Completed"
+	MigrationFailed        MigrationPhase = "Failed"
+)
+
+// MigrationEvent reports the progress of a live migration.
+type MigrationEvent struct {
+	Phase MigrationPhase
+	Time  time.Time
+	Err   error
+}
+
+type migrateOptions struct {
+	local    bool
+	progress func(MigrationEvent)
+}
+
+// MigrateOption configures a live migration.
+type MigrateOption func(*migrateOptions)
+
+// MigrateLocal hands the guest memory over to the destination instead of
+// copying it, for upgrading the vmm on the same host. The source vm needs
+// shared memory or hugepages.
+func MigrateLocal() MigrateOption {
+	return func(o *migrateOptions) {
+		o.local = true
+	}
+}
+
+// WithMigrationProgress calls fn every time the migration enters a new phase.
+func WithMigrationProgress(fn func(MigrationEvent)) MigrateOption {
+	return func(o *migrateOptions) {
+		o.progress = fn
+	}
+}
+
+// Migrate moves the running vm of src into dst. The vmm of dst is started by
+// Migrate and must not have been started before. Once the migration completes
+// the vmm of src exits and dst is running the vm. When the migration fails the
+// vm stays with src, which is resumed if the migration left it paused.
+func Migrate(ctx context.Context, src Machine, dst Machine, opts ...MigrateOption) error {
+	options := migrateOptions{
+		progress: func(MigrationEvent) {},
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	source, ok := src.(*MachineImpl)
+	if !ok {
+		return fmt.Errorf("source machine does not support migration")
+	}
+
+	destination, ok := dst.(*MachineImpl)
+	if !ok {
+		return fmt.Errorf("destination machine does not support migration")
+	}
+
+	report := func(phase MigrationPhase, err error) {
+		options.progress(MigrationEvent{Phase: phase, Time: time.Now(), Err: err})
+	}
+
+	report(MigrationPreparing, nil)
+
+	err := source.migrate(ctx, destination, options, report)
+	if err != nil {
+		report(MigrationFailed, err)
+		return err
+	}
+
+	report(MigrationCompleted, nil)
+
+	return nil
+}
+
+func (m *MachineImpl) migrate(ctx context.Context, dst *MachineImpl, options migrateOptions, report func(MigrationPhase, error)) error {
+	err := m.requireState("migrate vm", StateRunning, StatePaused)
+	if err != nil {
+		return err
+	}
+
+	info, err := m.Info(ctx)
+	if err != nil {
+		return err
+	}
+
+	if options.local && !sharedMemory(info.Config.Memory) {
+		return fmt.Errorf("local migration requires the vm to use shared memory or hugepages")
+	}
+
+	err = dst.launchVMM()
+	if err != nil {
+		return fmt.Errorf("could not start destination vmm: %w", err)
+	}
+
+	url := unixScheme + dst.runtimePath(migrationSocketName)
+
+	receiveCh := make(chan error, 1)
+	go func() {
+		resp, err := dst.client.PutVmReceiveMigration(ctx, api.ReceiveMigrationData{
+			ReceiverUrl: url,
+		})
+		receiveCh <- checkResponse("receive migration", resp, err, http.StatusNoContent)
+	}()
+
+	err = waitForFile(ctx, dst.runtimePath(migrationSocketName), receiveCh)
+	if err != nil {
+		return errors.Join(err, dst.shutdownVMM(ctx))
+	}
+
+	report(MigrationReceiverReady, nil)
+	report(MigrationSending, nil)
+
+	resp, err := m.client.PutVmSendMigration(ctx, api.SendMigrationData{
+		DestinationUrl: url,
+		Local:          &options.local,
+	})
+	err = checkResponse("send migration", resp, err, http.StatusNoContent)
+	if err != nil {
+		return errors.Join(err, m.recoverMigration(ctx), dst.shutdownVMM(ctx))
+	}
+
+	// the source can report success before the destination has taken over the
+	// vm, a failed receive leaves the vm with the source
+	err = <-receiveCh
+	if err != nil {
+		return errors.Join(err, m.recoverMigration(ctx), dst.shutdownVMM(ctx))
+	}
+
+	info, err = dst.Info(ctx)
+	if err != nil {
+		return err
+	}
+
+	dst.setConfig(info.Config)
+	dst.setState(StateRunning, nil)
+
+	// the source vmm exits once it has handed over the vm
+	return m.Wait(ctx)
+}
+
+// recoverMigration resumes the vm when a failed migration left it paused.
+func (m *MachineImpl) recoverMigration(ctx context.Context) error {
+	info, err := m.Info(ctx)
+	if err != nil {
+		return err
+	}
+
+	if info.State == api.Paused {
+		m.setState(StatePaused, nil)
+		return m.Resume(ctx)
+	}
+
+	return nil
+}
+
+func (m *MachineImpl) shutdownVMM(ctx context.Context) error {
+	resp, err := m.client.ShutdownVMM(ctx)
+	return checkResponse("shutdown vmm", resp, err, http.StatusNoContent)
+}
+
+// waitForFile waits until path exists, errCh aborts the wait early.
+func waitForFile(ctx context.Context, path string, errCh chan error) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errCh:
+			if err != nil {
+				return err
+			}
+
+			return fmt.Errorf("%s was not created", path)
+		case <-ticker.C:
+			if _, err := os.Stat(path); err == nil {
+				return nil
+			}
+		}
+	}
+}
+
+func sharedMemory(memory *api.MemoryConfig) bool {
+	if memory == nil {
+		return false
+	}
+
+	return (memory.Shared != nil && *memory.Shared) || (memory.Hugepages != nil && *memory.Hugepages)
+}
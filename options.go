@@ -0,0 +1,117 @@
+package sdk
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// WithBinary sets the path of the cloud-hypervisor binary, by default it is
+// looked up in the PATH.
+func WithBinary(path string) Option {
+	return func(m *MachineImpl) error {
+		m.binary = path
+		return nil
+	}
+}
+
+// WithArgs appends extra arguments to the cloud-hypervisor command line.
+func WithArgs(args ...string) Option {
+	return func(m *MachineImpl) error {
+		m.args = append(m.args, args...)
+		return nil
+	}
+}
+
+// WithVerbosity sets the number of -v flags passed to cloud-hypervisor.
+func WithVerbosity(level int) Option {
+	return func(m *MachineImpl) error {
+		if level < 0 {
+			return fmt.Errorf("verbosity can not be negative: %d", level)
+		}
+
+		m.verbosity = level
+		return nil
+	}
+}
+
+// WithStdout sets the writer that receives the stdout of the vmm.
+func WithStdout(w io.Writer) Option {
+	return func(m *MachineImpl) error {
+		m.stdout = w
+		return nil
+	}
+}
+
+// WithStderr sets the writer that receives the stderr of the vmm.
+func WithStderr(w io.Writer) Option {
+	return func(m *MachineImpl) error {
+		m.stderr = w
+		return nil
+	}
+}
+
+// WithStdin sets the reader the vmm reads its stdin from.
+func WithStdin(r io.Reader) Option {
+	return func(m *MachineImpl) error {
+		m.stdin = r
+		return nil
+	}
+}
+
+// WithBootTimeout sets how long Start waits for the vmm api to come up.
+func WithBootTimeout(timeout time.Duration) Option {
+	return func(m *MachineImpl) error {
+		if timeout <= 0 {
+			return fmt.Errorf("boot timeout must be positive: %s", timeout)
+		}
+
+		m.bootTimeout = timeout
+		return nil
+	}
+}
+
+// WithSocketPath sets the path of the api socket, by default the socket is
+// created inside the runtime dir of the machine.
+func WithSocketPath(path string) Option {
+	return func(m *MachineImpl) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		m.socketPath = abs
+		return nil
+	}
+}
+
+// WithRuntimeDir sets the directory that holds the api socket, serial and
+// console files, vsock and virtiofs sockets and the pid file of the machine.
+// The directory is created if it does not exist and is then removed when the
+// machine is deleted, from an existing directory only the pid files and
+// sockets of the sdk are removed.
+func WithRuntimeDir(dir string) Option {
+	return func(m *MachineImpl) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+
+		m.runtimeDir = abs
+		return nil
+	}
+}
+
+// WithLogger sets the logger used by the machine.
+func WithLogger(logger *log.Logger) Option {
+	return func(m *MachineImpl) error {
+		if logger == nil {
+			return fmt.Errorf("logger can not be nil")
+		}
+
+		m.logger = logger
+		return nil
+	}
+}
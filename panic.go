@@ -0,0 +1,239 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+const (
+	serialPollInterval = 500 * time.Millisecond
+	coredumpTimeout    = 5 * time.Minute
+	maxLogLine         = 32 * 1024
+)
+
+// panicPattern matches the line the linux kernel prints when it panics.
+var panicPattern = regexp.MustCompile(`Kernel panic - not syncing`)
+
+// watchdogPattern matches the line the vmm logs when the watchdog of the guest
+// expired, right before it resets the vm.
+var watchdogPattern = regexp.MustCompile(`Watchdog triggered`)
+
+// WithPvpanic adds a pvpanic device to the vm, the guest uses it to report
+// kernel panics to the vmm.
+func WithPvpanic() Option {
+	return func(m *MachineImpl) error {
+		enabled := true
+		m.config.Pvpanic = &enabled
+		return nil
+	}
+}
+
+// WithWatchdog adds a watchdog device to the vm, the vmm reboots the guest
+// when the watchdog in the guest stops feeding it. Such resets are sent on
+// Events as EventWatchdogReset and counted by a supervisor, they are detected
+// from the log of the vmm, so it has to log to stderr and not to a file.
+func WithWatchdog() Option {
+	return func(m *MachineImpl) error {
+		enabled := true
+		m.config.Watchdog = &enabled
+		return nil
+	}
+}
+
+// watchdogWriter passes the stderr of the vmm on and reports the watchdog
+// resets it logs.
+type watchdogWriter struct {
+	w     io.Writer
+	line  []byte
+	reset func(line string)
+}
+
+func (w *watchdogWriter) Write(p []byte) (int, error) {
+	w.line = append(w.line, p...)
+
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+
+		if watchdogPattern.Match(w.line[:i]) {
+			w.reset(string(bytes.TrimSpace(w.line[:i])))
+		}
+
+		w.line = w.line[i+1:]
+	}
+
+	// a log without newlines must not grow the buffer
+	if len(w.line) > maxLogLine {
+		w.line = w.line[len(w.line)-maxLogLine:]
+	}
+
+	if w.w == nil {
+		return len(p), nil
+	}
+
+	return w.w.Write(p)
+}
+
+// watchdogReset reports that the watchdog of the guest reset the vm.
+func (m *MachineImpl) watchdogReset(line string) {
+	m.logger.Printf("watchdog reset the vm: %s", line)
+
+	m.handleEvent(Event{
+		Time:    time.Now(),
+		Elapsed: time.Since(m.StartedAt()),
+		Source:  EventSourceDevice,
+		Type:    EventWatchdogReset,
+	})
+}
+
+// WithSerialPanicDetection watches the serial output of the vm for kernel
+// panics, for guests without a pvpanic driver. The serial must be in File mode.
+func WithSerialPanicDetection() Option {
+	return func(m *MachineImpl) error {
+		if m.config.Serial == nil || m.config.Serial.Mode != api.ConsoleConfigModeFile {
+			return fmt.Errorf("serial panic detection requires the serial to be in %s mode", api.ConsoleConfigModeFile)
+		}
+
+		m.watchSerial = true
+		return nil
+	}
+}
+
+// WithCoredumpOnPanic pauses the vm and writes a coredump of the guest to dir
+// when the guest panics.
+func WithCoredumpOnPanic(dir string) Option {
+	return func(m *MachineImpl) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+
+		m.coredumpDir = abs
+		return nil
+	}
+}
+
+// guestPanicked records a guest panic, Wait returns ErrGuestPanicked from
+// then on.
+func (m *MachineImpl) guestPanicked(reason string) {
+	m.panicOnce.Do(func() {
+		m.logger.Printf("guest panicked: %s", reason)
+
+		m.panicErr = fmt.Errorf("%w: %s", ErrGuestPanicked, reason)
+		close(m.panicCh)
+
+		if m.coredumpDir == "" {
+			return
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), coredumpTimeout)
+			defer cancel()
+
+			path := filepath.Join(m.coredumpDir, fmt.Sprintf("%s-%d.core", m.id, time.Now().Unix()))
+			err := m.coredumpOnPanic(ctx, path)
+			if err != nil {
+				m.logger.Printf("could not write coredump: %s", err)
+				return
+			}
+
+			m.logger.Printf("wrote coredump to %s", path)
+		}()
+	})
+}
+
+func (m *MachineImpl) coredumpOnPanic(ctx context.Context, path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	if m.State() == StateRunning {
+		err := m.Pause(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.coredump(ctx, path)
+}
+
+// watchSerialOutput follows the serial file of the vm and reports a guest
+// panic when the kernel prints one.
+func (m *MachineImpl) watchSerialOutput() {
+	path := *m.config.Serial.File
+
+	ticker := time.NewTicker(serialPollInterval)
+	defer ticker.Stop()
+
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	line := []byte{}
+
+	for {
+		select {
+		case <-m.exitCh:
+			return
+		case <-m.panicCh:
+			return
+		case <-ticker.C:
+		}
+
+		if f == nil {
+			var err error
+			f, err = os.Open(path)
+			if err != nil {
+				continue
+			}
+		}
+
+		for {
+			n, err := f.Read(buf)
+			line = append(line, buf[:n]...)
+
+			for {
+				i := bytes.IndexByte(line, '\n')
+				if i < 0 {
+					break
+				}
+
+				if panicPattern.Match(line[:i]) {
+					m.guestPanicked(string(bytes.TrimSpace(line[:i])))
+					return
+				}
+
+				line = line[i+1:]
+			}
+
+			// a guest that never prints a newline must not grow the buffer
+			if len(line) > len(buf) {
+				line = line[len(line)-len(buf):]
+			}
+
+			if err == io.EOF || n == 0 {
+				break
+			}
+
+			if err != nil {
+				m.logger.Printf("could not read serial output: %s", err)
+				return
+			}
+		}
+	}
+}
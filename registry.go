@@ -0,0 +1,340 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/internal/proc"
+)
+
+const (
+	registryLockName = ".lock"
+	recordExtension  = ".json"
+	// pidReuseTolerance is how far the start time of a process may be from the
+	// recorded one for it to still be the vmm of the record.
+	pidReuseTolerance = 2 * time.Second
+)
+
+// MachineRecord is the persisted state of a machine.
+type MachineRecord struct {
+	ID         string       `json:"id"`
+	Config     api.VmConfig `json:"config"`
+	RuntimeDir string       `json:"runtime_dir"`
+	SocketPath string       `json:"socket_path"`
+	PID        int          `json:"pid"`
+	StartedAt  time.Time    `json:"started_at"`
+	State      State        `json:"state"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// Registry persists the state of machines as json files in a directory, so
+// that they can be found and attached to after the program restarts. The
+// directory is locked while it is read or written, so several processes can
+// share a registry.
+type Registry struct {
+	dir string
+}
+
+// NewRegistry creates a registry in dir, creating the directory if needed.
+func NewRegistry(dir string) (*Registry, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("could not create registry: %w", err)
+	}
+
+	return &Registry{dir: dir}, nil
+}
+
+// Register records the machine and keeps its state up to date until the
+// context is cancelled, the machine exits or its record is removed. Machines are usually registered
+// right after they have been started, when their pid is known.
+func (r *Registry) Register(ctx context.Context, m Machine) error {
+	record := newMachineRecord(m)
+
+	err := r.put(record)
+	if err != nil {
+		return err
+	}
+
+	events := m.Subscribe(ctx)
+	go func() {
+		for event := range events {
+			record.State = event.To
+			if pid, err := m.PID(); err == nil {
+				record.PID = pid
+			}
+
+			// stop once the record has been removed
+			err := r.update(record)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Get returns the record of the machine with the given id.
+func (r *Registry) Get(id string) (*MachineRecord, error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return r.read(id)
+}
+
+// List returns the records of all machines, ordered by start time.
+func (r *Registry) List() ([]MachineRecord, error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return r.list()
+}
+
+// Remove deletes the record of the machine with the given id.
+func (r *Registry) Remove(id string) error {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = os.Remove(r.recordPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("machine %s: %w", id, ErrMachineNotFound)
+	}
+
+	return err
+}
+
+// Reconcile removes the records of machines whose vmm process is gone and
+// returns them.
+func (r *Registry) Reconcile() ([]MachineRecord, error) {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	records, err := r.list()
+	if err != nil {
+		return nil, err
+	}
+
+	stale := []MachineRecord{}
+	for _, record := range records {
+		if record.running() {
+			continue
+		}
+
+		err := os.Remove(r.recordPath(record.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return stale, err
+		}
+
+		stale = append(stale, record)
+	}
+
+	return stale, nil
+}
+
+// Attach attaches to the running machine with the given id.
+func (r *Registry) Attach(ctx context.Context, id string, opts ...Option) (Machine, error) {
+	record, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return AttachMachine(ctx, record.SocketPath, opts...)
+}
+
+// running reports whether the vmm of the record is still running. A process
+// with the pid that was started at another time reuses the pid of a vmm that
+// is gone.
+func (r MachineRecord) running() bool {
+	if r.PID == 0 || !processExists(r.PID) {
+		return false
+	}
+
+	started, err := proc.StartTime(r.PID)
+	if err != nil || r.StartedAt.IsZero() {
+		return true
+	}
+
+	// the boot time is only known to the second
+	diff := started.Sub(r.StartedAt)
+	return diff > -pidReuseTolerance && diff < pidReuseTolerance
+}
+
+func newMachineRecord(m Machine) *MachineRecord {
+	record := &MachineRecord{
+		ID:        m.ID(),
+		Config:    m.Config(),
+		StartedAt: m.StartedAt(),
+		State:     m.State(),
+	}
+
+	if pid, err := m.PID(); err == nil {
+		record.PID = pid
+	}
+
+	if paths, ok := m.(interface {
+		RuntimeDir() string
+		SocketPath() string
+	}); ok {
+		record.RuntimeDir = paths.RuntimeDir()
+		record.SocketPath = paths.SocketPath()
+	}
+
+	return record
+}
+
+func (r *Registry) put(record *MachineRecord) error {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return r.write(record)
+}
+
+// update writes the record only when it exists, so a machine that has been
+// removed is not recorded again.
+func (r *Registry) update(record *MachineRecord) error {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, err = os.Stat(r.recordPath(record.ID))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("machine %s: %w", record.ID, ErrMachineNotFound)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return r.write(record)
+}
+
+func (r *Registry) write(record *MachineRecord) error {
+	record.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so readers never see a partial record
+	tmp, err := os.CreateTemp(r.dir, record.ID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), r.recordPath(record.ID))
+}
+
+func (r *Registry) read(id string) (*MachineRecord, error) {
+	data, err := os.ReadFile(r.recordPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("machine %s: %w", id, ErrMachineNotFound)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := &MachineRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, fmt.Errorf("could not read record of machine %s: %w", id, err)
+	}
+
+	return record, nil
+}
+
+func (r *Registry) list() ([]MachineRecord, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []MachineRecord{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, recordExtension) {
+			continue
+		}
+
+		record, err := r.read(strings.TrimSuffix(name, recordExtension))
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, *record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].StartedAt.Before(records[j].StartedAt)
+	})
+
+	return records, nil
+}
+
+func (r *Registry) recordPath(id string) string {
+	return filepath.Join(r.dir, filepath.Base(id)+recordExtension)
+}
+
+// lock takes a shared or exclusive lock on the registry and returns the
+// function that releases it.
+func (r *Registry) lock(exclusive bool) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(r.dir, registryLockName), os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(f, exclusive)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not lock registry: %w", err)
+	}
+
+	return func() {
+		unlockFile(f, exclusive)
+		f.Close()
+	}, nil
+}
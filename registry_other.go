@@ -0,0 +1,30 @@
+//go:build !unix
+
+package sdk
+
+import (
+	"os"
+	"sync"
+)
+
+// registryMu stands in for file locks on platforms without flock, it only
+// keeps the registries of this process from racing each other.
+var registryMu sync.RWMutex
+
+func lockFile(f *os.File, exclusive bool) error {
+	if exclusive {
+		registryMu.Lock()
+	} else {
+		registryMu.RLock()
+	}
+
+	return nil
+}
+
+func unlockFile(f *os.File, exclusive bool) {
+	if exclusive {
+		registryMu.Unlock()
+	} else {
+		registryMu.RUnlock()
+	}
+}
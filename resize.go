@@ -0,0 +1,305 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/units"
+)
+
+const (
+	resizePollInterval = 100 * time.Millisecond
+	resizeTimeout      = 30 * time.Second
+)
+
+// ResizeRequest describes the desired size of a running vm, fields left at
+// their zero value are not changed.
+type ResizeRequest struct {
+	// Vcpus is the number of vcpus, between 1 and CpusConfig.MaxVcpus.
+	Vcpus int
+	// RAM is the total memory in bytes, between MemoryConfig.Size and
+	// MemoryConfig.Size + MemoryConfig.HotplugSize.
+	RAM int64
+	// Balloon is the size of the balloon in bytes, the vm needs a balloon
+	// device. A pointer because a size of zero deflates the balloon.
+	Balloon *int64
+}
+
+// NewResizeRequest creates a resize request from sizes like 2G or 512MiB, an
+// empty size leaves the memory or balloon unchanged and zero vcpus leaves the
+// vcpus unchanged.
+func NewResizeRequest(vcpus int, ram string, balloon string) (ResizeRequest, error) {
+	request := ResizeRequest{
+		Vcpus: vcpus,
+	}
+
+	if ram != "" {
+		bytes, err := units.ParseSize(ram)
+		if err != nil {
+			return ResizeRequest{}, fmt.Errorf("ram: %w", err)
+		}
+
+		request.RAM = bytes
+	}
+
+	if balloon != "" {
+		bytes, err := units.ParseSize(balloon)
+		if err != nil {
+			return ResizeRequest{}, fmt.Errorf("balloon: %w", err)
+		}
+
+		request.Balloon = &bytes
+	}
+
+	return request, nil
+}
+
+// Resize changes the number of vcpus, the memory or the balloon size of the
+// vm and waits until the vmm reports the new size.
+func (m *MachineImpl) Resize(ctx context.Context, request ResizeRequest) error {
+	err := m.requireState("resize vm", StateRunning, StatePaused)
+	if err != nil {
+		return err
+	}
+
+	info, err := m.Info(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = validateResize(info.Config, request)
+	if err != nil {
+		return err
+	}
+
+	resize := api.VmResize{
+		DesiredBalloon: request.Balloon,
+	}
+
+	if request.Vcpus != 0 {
+		resize.DesiredVcpus = &request.Vcpus
+	}
+
+	if request.RAM != 0 {
+		resize.DesiredRam = &request.RAM
+	}
+
+	resp, err := m.client.PutVmResize(ctx, resize)
+	err = checkResponse("resize vm", resp, err, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+
+	ram := memorySize(info.Config.Memory)
+	if request.RAM != 0 {
+		ram = request.RAM
+	}
+
+	balloon := int64(0)
+	if info.Config.Balloon != nil {
+		balloon = info.Config.Balloon.Size
+	}
+
+	if request.Balloon != nil {
+		balloon = *request.Balloon
+	}
+
+	info, err = m.waitForInfo(ctx, "resize vm", func(info *api.VmInfo) bool {
+		if request.Vcpus != 0 && (info.Config.Cpus == nil || info.Config.Cpus.BootVcpus != request.Vcpus) {
+			return false
+		}
+
+		// only wait for the memory when it was resized, a guest without a
+		// balloon driver never reports the configured size
+		if request.RAM == 0 && request.Balloon == nil {
+			return true
+		}
+
+		return info.MemoryActualSize == nil || *info.MemoryActualSize == ram-balloon
+	})
+	if err != nil {
+		return err
+	}
+
+	m.setConfig(info.Config)
+
+	return nil
+}
+
+// ResizeZone changes the size of the memory zone with the given id and waits
+// until the vmm reports the new size.
+func (m *MachineImpl) ResizeZone(ctx context.Context, id string, size int64) error {
+	err := m.requireState("resize zone", StateRunning, StatePaused)
+	if err != nil {
+		return err
+	}
+
+	info, err := m.Info(ctx)
+	if err != nil {
+		return err
+	}
+
+	zone, err := findMemoryZone(info.Config.Memory, id)
+	if err != nil {
+		return err
+	}
+
+	err = validateMemory(fmt.Sprintf("memory zone %s", id), size, zone.Size, zone.HotplugSize)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.PutVmResizeZone(ctx, api.VmResizeZone{
+		Id:         &id,
+		DesiredRam: &size,
+	})
+	err = checkResponse("resize zone", resp, err, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+
+	info, err = m.waitForInfo(ctx, "resize zone", func(info *api.VmInfo) bool {
+		zone, err := findMemoryZone(info.Config.Memory, id)
+		if err != nil {
+			return false
+		}
+
+		hotplugged := int64(0)
+		if zone.HotpluggedSize != nil {
+			hotplugged = *zone.HotpluggedSize
+		}
+
+		return zone.Size+hotplugged == size
+	})
+	if err != nil {
+		return err
+	}
+
+	m.setConfig(info.Config)
+
+	return nil
+}
+
+// waitForInfo polls the vm info until done returns true, the context is
+// cancelled or resizeTimeout passes. The vmm applies a resize asynchronously,
+// a guest without a balloon or memory hotplug driver never catches up.
+func (m *MachineImpl) waitForInfo(ctx context.Context, op string, done func(info *api.VmInfo) bool) (*api.VmInfo, error) {
+	ticker := time.NewTicker(resizePollInterval)
+	defer ticker.Stop()
+
+	timeout := time.NewTimer(resizeTimeout)
+	defer timeout.Stop()
+
+	for {
+		info, err := m.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if done(info) {
+			return info, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout.C:
+			return nil, fmt.Errorf("could not %s: the vm did not reach the new size within %s, check that the guest has a balloon or memory hotplug driver", op, resizeTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+func validateResize(config api.VmConfig, request ResizeRequest) error {
+	if request.Vcpus < 0 {
+		return fmt.Errorf("vcpus can not be negative: %d", request.Vcpus)
+	}
+
+	if request.Vcpus != 0 && config.Cpus != nil && request.Vcpus != config.Cpus.BootVcpus {
+		if config.Cpus.MaxVcpus == config.Cpus.BootVcpus {
+			return fmt.Errorf("could not resize vcpus to %d: %w, max vcpus is %d", request.Vcpus, ErrNoHotplugHeadroom, config.Cpus.MaxVcpus)
+		}
+
+		if request.Vcpus > config.Cpus.MaxVcpus {
+			return fmt.Errorf("could not resize vcpus to %d: exceeds max vcpus %d", request.Vcpus, config.Cpus.MaxVcpus)
+		}
+	}
+
+	if request.RAM != 0 && config.Memory != nil {
+		err := validateMemory("memory", request.RAM, config.Memory.Size, config.Memory.HotplugSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	if request.Balloon != nil {
+		if config.Balloon == nil {
+			return fmt.Errorf("could not resize balloon: vm has no balloon device")
+		}
+
+		if *request.Balloon < 0 {
+			return fmt.Errorf("balloon size can not be negative: %d", *request.Balloon)
+		}
+
+		ram := memorySize(config.Memory)
+		if request.RAM != 0 {
+			ram = request.RAM
+		}
+
+		if *request.Balloon >= ram {
+			return fmt.Errorf("could not resize balloon to %s: exceeds memory size %s", units.Size(*request.Balloon), units.Size(ram))
+		}
+	}
+
+	return nil
+}
+
+func validateMemory(name string, size int64, base int64, hotplugSize *int64) error {
+	if size == base {
+		return nil
+	}
+
+	if hotplugSize == nil || *hotplugSize == 0 {
+		return fmt.Errorf("could not resize %s to %s: %w", name, units.Size(size), ErrNoHotplugHeadroom)
+	}
+
+	if size < base {
+		return fmt.Errorf("could not resize %s to %s: smaller than boot size %s", name, units.Size(size), units.Size(base))
+	}
+
+	if size > base+*hotplugSize {
+		return fmt.Errorf("could not resize %s to %s: exceeds boot size %s plus hotplug size %s", name, units.Size(size), units.Size(base), units.Size(*hotplugSize))
+	}
+
+	return nil
+}
+
+// memorySize returns the current memory of the vm including hotplugged memory.
+func memorySize(memory *api.MemoryConfig) int64 {
+	if memory == nil {
+		return 0
+	}
+
+	size := memory.Size
+	if memory.HotpluggedSize != nil {
+		size += *memory.HotpluggedSize
+	}
+
+	return size
+}
+
+func findMemoryZone(memory *api.MemoryConfig, id string) (*api.MemoryZoneConfig, error) {
+	if memory != nil && memory.Zones != nil {
+		for i := range *memory.Zones {
+			zone := &(*memory.Zones)[i]
+			if zone.Id == id {
+				return zone, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("memory zone %s does not exist", id)
+}
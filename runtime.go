@@ -0,0 +1,184 @@
+package sdk
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+const (
+	runtimeDirName = "cloudhypervisor-sdk"
+	apiSocketName  = "api.sock"
+	serialName     = "serial.log"
+	consoleName    = "console.log"
+	vsockName      = "vsock.sock"
+	virtiofsName   = "virtiofs.sock"
+	pidFileName    = "vmm.pid"
+	ownerFileName  = "owner.pid"
+)
+
+// runtimeBaseDir is the directory in which the runtime directories of all
+// machines created by the sdk are allocated.
+func runtimeBaseDir() string {
+	return filepath.Join(os.TempDir(), runtimeDirName)
+}
+
+func newMachineID() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func (m *MachineImpl) createRuntimeDir() error {
+	if m.runtimeDir == "" {
+		m.runtimeDir = filepath.Join(runtimeBaseDir(), m.id)
+	}
+
+	parent := filepath.Dir(m.runtimeDir)
+	err := os.MkdirAll(parent, 0700)
+	if err != nil {
+		return fmt.Errorf("could not create runtime dir: %w", err)
+	}
+
+	if m.socketPath == "" {
+		m.socketPath = m.runtimePath(apiSocketName)
+	}
+
+	// only a dir created here is removed with the machine, a dir that existed
+	// before may hold files of the user
+	_, err = os.Stat(m.runtimeDir)
+	if err == nil {
+		return m.writeOwnerFile()
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not create runtime dir: %w", err)
+	}
+
+	// the dir is created under a hidden name together with its owner file and
+	// then renamed, so the garbage collector never sees it without an owner
+	tmp, err := os.MkdirTemp(parent, "."+filepath.Base(m.runtimeDir)+"-")
+	if err != nil {
+		return fmt.Errorf("could not create runtime dir: %w", err)
+	}
+
+	err = writeOwner(tmp)
+	if err == nil {
+		err = os.Rename(tmp, m.runtimeDir)
+	}
+
+	if err != nil {
+		return errors.Join(fmt.Errorf("could not create runtime dir: %w", err), os.RemoveAll(tmp))
+	}
+
+	m.createdRuntimeDir = true
+	return nil
+}
+
+// writeOwnerFile records this process as the owner of the runtime dir, the
+// garbage collector leaves runtime dirs with a live owner alone.
+func (m *MachineImpl) writeOwnerFile() error {
+	return writeOwner(m.runtimeDir)
+}
+
+func writeOwner(dir string) error {
+	return os.WriteFile(filepath.Join(dir, ownerFileName), []byte(strconv.Itoa(os.Getpid())), 0600)
+}
+
+// readPIDFile reads a pid written by writePIDFile or writeOwnerFile.
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// removeRuntimeDir removes the runtime dir if the sdk created it, from a dir
+// that already existed only the pid files and sockets of the sdk are removed.
+func (m *MachineImpl) removeRuntimeDir() error {
+	if m.runtimeDir == "" || m.keepRuntimeDir {
+		return nil
+	}
+
+	if m.createdRuntimeDir {
+		return os.RemoveAll(m.runtimeDir)
+	}
+
+	errs := []error{}
+	for _, name := range []string{ownerFileName, pidFileName, apiSocketName, vsockName} {
+		err := os.Remove(m.runtimePath(name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *MachineImpl) runtimePath(name string) string {
+	return filepath.Join(m.runtimeDir, name)
+}
+
+// setRuntimePaths points every file or socket in the config that was left
+// empty at a location inside the runtime dir of the machine.
+func (m *MachineImpl) setRuntimePaths() {
+	if m.config.Serial != nil && m.config.Serial.File == nil && m.config.Serial.Mode == api.ConsoleConfigModeFile {
+		path := m.runtimePath(serialName)
+		m.config.Serial.File = &path
+	}
+
+	if m.config.Console != nil && m.config.Console.File == nil && m.config.Console.Mode == api.ConsoleConfigModeFile {
+		path := m.runtimePath(consoleName)
+		m.config.Console.File = &path
+	}
+
+	if m.config.Vsock != nil && m.config.Vsock.Socket == "" {
+		m.config.Vsock.Socket = m.runtimePath(vsockName)
+	}
+
+	if m.config.Fs != nil {
+		for i := range *m.config.Fs {
+			fs := &(*m.config.Fs)[i]
+			if fs.Socket == "" {
+				fs.Socket = m.runtimePath(fmt.Sprintf("virtiofs-%d.sock", i))
+			}
+		}
+	}
+}
+
+func (m *MachineImpl) writePIDFile() error {
+	pid, err := m.PID()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(m.runtimePath(pidFileName), []byte(strconv.Itoa(pid)), 0600)
+}
+
+// ID returns the unique identifier of the machine.
+func (m *MachineImpl) ID() string {
+	return m.id
+}
+
+// RuntimeDir returns the directory holding the sockets and files of the machine.
+func (m *MachineImpl) RuntimeDir() string {
+	return m.runtimeDir
+}
+
+// SocketPath returns the path of the api socket of the machine.
+func (m *MachineImpl) SocketPath() string {
+	return m.socketPath
+}
@@ -0,0 +1,101 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+const virtiofsThreads = 4
+
+// share is a host directory that is exported to the guest by a virtiofsd.
+type share struct {
+	// index of the fs device in the config
+	index int
+	dir   string
+}
+
+// WithShare shares the host directory dir with the guest through virtio-fs,
+// the guest mounts it by tag. Start runs a virtiofsd for every share, it has
+// to be in the PATH. Virtio-fs needs shared memory, which is turned on.
+func WithShare(tag string, dir string) Option {
+	return func(m *MachineImpl) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stat(abs)
+		if err != nil {
+			return fmt.Errorf("could not share %s: %w", dir, err)
+		}
+
+		index := length(m.config.Fs)
+		id := fmt.Sprintf("fs%d", index)
+
+		m.config.Fs = appendDevice(m.config.Fs, api.FsConfig{
+			Id:        &id,
+			Tag:       tag,
+			NumQueues: defaultQueues,
+			QueueSize: defaultQueueSize,
+		})
+
+		if m.config.Memory == nil {
+			m.config.Memory = &api.MemoryConfig{
+				Size: defaultMemory,
+			}
+		}
+
+		shared := true
+		m.config.Memory.Shared = &shared
+
+		m.shares = append(m.shares, share{index: index, dir: abs})
+		return nil
+	}
+}
+
+// startShares starts a virtiofsd for every share and waits for its socket.
+// The daemons are killed when the vmm exits.
+func (m *MachineImpl) startShares() error {
+	for _, share := range m.shares {
+		socket := (*m.config.Fs)[share.index].Socket
+
+		cmd, err := newVirtioFSCommand(socket, []string{share.dir}, virtiofsThreads)
+		if err != nil {
+			return err
+		}
+
+		cmd.Stdout = m.stdout
+		cmd.Stderr = m.stderr
+		cmd.Stdin = nil
+		cmd.SysProcAttr = m.sysProcAttr()
+
+		err = cmd.Start()
+		if err != nil {
+			return fmt.Errorf("could not start virtiofsd for %s: %w", share.dir, err)
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- cmd.Wait()
+		}()
+
+		go func() {
+			<-m.exitCh
+			cmd.Process.Kill()
+		}()
+
+		ctx, cancel := context.WithTimeout(m.context, m.bootTimeout)
+		err = waitForFile(ctx, socket, errCh)
+		cancel()
+
+		if err != nil {
+			return fmt.Errorf("could not start virtiofsd for %s: %w", share.dir, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,318 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+const (
+	fileScheme         = "file://"
+	snapshotConfigName = "config.json"
+)
+
+type snapshotOptions struct {
+	resume bool
+}
+
+// SnapshotOption configures how a snapshot is taken.
+type SnapshotOption func(*snapshotOptions)
+
+// ResumeAfterSnapshot resumes the vm once the snapshot has been written.
+// Without it the vm is left paused.
+func ResumeAfterSnapshot() SnapshotOption {
+	return func(o *snapshotOptions) {
+		o.resume = true
+	}
+}
+
+type restoreOptions struct {
+	prefault bool
+	resume   bool
+}
+
+// RestoreOption configures how a snapshot is restored.
+type RestoreOption func(*restoreOptions)
+
+// PrefaultMemory loads the whole guest memory from the snapshot up front
+// instead of on demand.
+func PrefaultMemory() RestoreOption {
+	return func(o *restoreOptions) {
+		o.prefault = true
+	}
+}
+
+// ResumeAfterRestore resumes the vm once it has been restored. Without it the
+// vm is left paused.
+func ResumeAfterRestore() RestoreOption {
+	return func(o *restoreOptions) {
+		o.resume = true
+	}
+}
+
+// Snapshot pauses the vm when it is running and writes a snapshot of it to
+// the destination directory, which must exist and be empty.
+func (m *MachineImpl) Snapshot(ctx context.Context, destination string, opts ...SnapshotOption) error {
+	options := snapshotOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	err := m.requireState("snapshot vm", StateRunning, StatePaused)
+	if err != nil {
+		return err
+	}
+
+	dir, err := localPath(destination)
+	if err != nil {
+		return err
+	}
+
+	err = checkEmptyDir(dir)
+	if err != nil {
+		return err
+	}
+
+	paused := false
+	if m.State() == StateRunning {
+		err = m.Pause(ctx)
+		if err != nil {
+			return err
+		}
+
+		paused = true
+	}
+
+	url := fileScheme + dir
+	resp, err := m.client.PutVmSnapshot(ctx, api.VmSnapshotConfig{
+		DestinationUrl: &url,
+	})
+	err = checkResponse("snapshot vm", resp, err, http.StatusNoContent)
+	if err != nil {
+		// leave the vm in the state we found it in
+		if paused {
+			resumeErr := m.Resume(ctx)
+			if resumeErr != nil {
+				return errors.Join(err, resumeErr)
+			}
+		}
+
+		return err
+	}
+
+	if options.resume {
+		return m.Resume(ctx)
+	}
+
+	return nil
+}
+
+// restore restores the vm from the snapshot in the source directory while the
+// vmm is starting, before a vm has been created. Use NewMachineFromSnapshot to
+// restore a machine.
+func (m *MachineImpl) restore(ctx context.Context, source string, opts ...RestoreOption) error {
+	options := restoreOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	err := m.requireState("restore vm", StateVMMStarting)
+	if err != nil {
+		return err
+	}
+
+	dir, err := localPath(source)
+	if err != nil {
+		return err
+	}
+
+	config, err := readSnapshotConfig(dir)
+	if err != nil {
+		return err
+	}
+
+	err = checkRestorePaths(config)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.PutVmRestore(ctx, api.RestoreConfig{
+		SourceUrl: fileScheme + dir,
+		Prefault:  &options.prefault,
+	})
+	err = checkResponse("restore vm", resp, err, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+
+	m.setState(StatePaused, nil)
+
+	if options.resume {
+		return m.Resume(ctx)
+	}
+
+	return nil
+}
+
+// localPath turns a path or file:// url into an absolute path.
+func localPath(location string) (string, error) {
+	if strings.Contains(location, "://") && !strings.HasPrefix(location, fileScheme) {
+		return "", fmt.Errorf("unsupported location %s, only %s is supported", location, fileScheme)
+	}
+
+	return filepath.Abs(strings.TrimPrefix(location, fileScheme))
+}
+
+func checkEmptyDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	_, err = f.Readdirnames(1)
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%s is not empty", dir)
+}
+
+// NewMachineFromSnapshot creates a machine that is restored from the snapshot
+// in snapshotDir instead of being created and booted when it is started, it is
+// the way to restore a snapshot taken with Machine.Snapshot. The config of the
+// machine is read back from the vmm once it has been restored.
+//
+// The restored vm keeps the serial and console files and the vsock and
+// virtio-fs sockets of the machine the snapshot was taken from, they can not
+// be changed on restore. Snapshots meant to be restored more than once, or
+// after that machine has been deleted, should be taken from a machine whose
+// files are outside of its runtime dir and that has no vsock device.
+func NewMachineFromSnapshot(ctx context.Context, snapshotDir string, opts ...Option) (Machine, error) {
+	dir, err := localPath(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := readSnapshotConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := newMachine(ctx, config, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	m.snapshot = dir
+
+	return m, nil
+}
+
+// WithRestoreOptions sets the options used when a machine created with
+// NewMachineFromSnapshot is restored.
+func WithRestoreOptions(opts ...RestoreOption) Option {
+	return func(m *MachineImpl) error {
+		m.restoreOpts = append(m.restoreOpts, opts...)
+		return nil
+	}
+}
+
+func (m *MachineImpl) restoreVM() error {
+	err := m.restore(m.context, m.snapshot, m.restoreOpts...)
+	if err != nil {
+		return err
+	}
+
+	info, err := m.Info(m.context)
+	if err != nil {
+		return err
+	}
+
+	m.setConfig(info.Config)
+
+	return nil
+}
+
+// readSnapshotConfig reads the vm config stored in a snapshot. The file holds
+// the internal config of the vmm, only the fields shared with api.VmConfig are
+// used.
+func readSnapshotConfig(dir string) (api.VmConfig, error) {
+	config := api.VmConfig{}
+
+	data, err := os.ReadFile(filepath.Join(dir, snapshotConfigName))
+	if err != nil {
+		return config, fmt.Errorf("%s is not a snapshot: %w", dir, err)
+	}
+
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("could not read snapshot config: %w", err)
+	}
+
+	return config, nil
+}
+
+// checkRestorePaths checks that the files and sockets in the config of a
+// snapshot can be used, they still point at the machine it was taken from.
+func checkRestorePaths(config api.VmConfig) error {
+	errs := []error{}
+	checkDir := func(field string, path string) {
+		_, err := os.Stat(filepath.Dir(path))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		}
+	}
+
+	if config.Serial != nil && config.Serial.File != nil {
+		checkDir("serial.file", *config.Serial.File)
+	}
+
+	if config.Console != nil && config.Console.File != nil {
+		checkDir("console.file", *config.Console.File)
+	}
+
+	if config.Vsock != nil && config.Vsock.Socket != "" {
+		checkDir("vsock.socket", config.Vsock.Socket)
+
+		// the vmm binds the socket, it exists while another vm uses it
+		_, err := os.Stat(config.Vsock.Socket)
+		if err == nil {
+			errs = append(errs, fmt.Errorf("vsock.socket: %s is already in use", config.Vsock.Socket))
+		}
+	}
+
+	for i, fs := range deref(config.Fs) {
+		_, err := os.Stat(fs.Socket)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("fs[%d].socket: %w", i, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("could not restore vm, the snapshot uses paths of the machine it was taken from: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
@@ -0,0 +1,697 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/units"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+)
+
+const variablesKey = "variables"
+
+// variablePattern matches ${var.name} and ${env.NAME} in yaml and json specs,
+// $${...} escapes the reference.
+var variablePattern = regexp.MustCompile(`\$?\$\{\s*(var|env)\.([A-Za-z_][A-Za-z0-9_]*)\s*\}`)
+
+// sizePaths are the fields of the vm config that hold an amount of memory,
+// they can be written as sizes like 1GiB in a spec. [] stands for every item
+// of a list.
+var sizePaths = [][]string{
+	{"memory", "size"},
+	{"memory", "hotplug_size"},
+	{"memory", "hotplugged_size"},
+	{"memory", "hugepage_size"},
+	{"memory", "zones", "[]", "size"},
+	{"memory", "zones", "[]", "hotplug_size"},
+	{"memory", "zones", "[]", "hotplugged_size"},
+	{"memory", "zones", "[]", "hugepage_size"},
+	{"balloon", "size"},
+	{"pmem", "[]", "size"},
+	{"sgx_epc", "[]", "size"},
+}
+
+// reference is a string that consists of a single variable reference, it is
+// converted to the type of the field it is assigned to, so numbers and bools
+// can be set from variables.
+type reference string
+
+// MachineSpec is the declarative definition of a machine. Next to the vm
+// config it describes the disk images, cloud-init disk and virtio-fs shares the
+// machine needs. Relative paths are relative to the directory of the spec.
+type MachineSpec struct {
+	Name string `json:"name"`
+	// Variables are the defaults of the variables referenced in the spec.
+	Variables map[string]string `json:"variables,omitempty"`
+	// VM is the vm config, sizes can be written like 512M or 1GiB.
+	VM        api.VmConfig   `json:"vm"`
+	Images    []ImageSpec    `json:"images,omitempty"`
+	CloudInit *CloudInitSpec `json:"cloud_init,omitempty"`
+	Shares    []ShareSpec    `json:"shares,omitempty"`
+}
+
+// ImageSpec is a disk image that is created when it does not exist and is
+// attached to the vm.
+type ImageSpec struct {
+	Path string `json:"path"`
+	// Source is copied to Path when Path does not exist.
+	Source string `json:"source,omitempty"`
+	// Size is the size the image is created with or grown to.
+	Size     units.Size `json:"size,omitempty"`
+	Readonly bool       `json:"readonly,omitempty"`
+}
+
+// CloudInitSpec is the user and network configuration written to a cloud-init
+// disk that is attached to the vm.
+type CloudInitSpec struct {
+	// Path of the disk, it defaults to <name>-cloudinit.iso next to the spec.
+	Path     string `json:"path,omitempty"`
+	Hostname string `json:"hostname"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Mac is the mac address of the interface that is configured, it has to
+	// match one of the network interfaces of the vm.
+	Mac     string `json:"mac"`
+	CIDR    string `json:"cidr"`
+	Gateway string `json:"gateway"`
+}
+
+// ShareSpec is a host directory shared with the guest through virtio-fs.
+type ShareSpec struct {
+	Tag  string `json:"tag"`
+	Path string `json:"path"`
+}
+
+// LoadMachineSpec reads the spec at path and creates the machine it defines.
+func LoadMachineSpec(ctx context.Context, path string, opts ...Option) (Machine, error) {
+	spec, err := ReadMachineSpec(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return spec.NewMachine(ctx, opts...)
+}
+
+// ReadMachineSpec reads a yaml, json or hcl spec, picked by the extension of
+// path. Variables override the defaults in the spec. Yaml and json specs
+// reference variables as ${var.name} and environment variables as
+// ${env.NAME}, hcl specs use var.name and env.NAME expressions. A value that
+// is a single reference takes the type of its field, so boot_vcpus:
+// ${var.cpus} sets a number.
+func ReadMachineSpec(path string, variables map[string]string) (*MachineSpec, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read machine spec: %w", err)
+	}
+
+	var tree map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+		if err == nil {
+			err = interpolate(tree, variables)
+		}
+
+		convertReferences(tree, reflect.TypeOf(MachineSpec{}))
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		err = decoder.Decode(&tree)
+		if err == nil {
+			err = interpolate(tree, variables)
+		}
+
+		convertReferences(tree, reflect.TypeOf(MachineSpec{}))
+	case ".hcl":
+		tree, err = decodeHCL(data, path, variables)
+		if err == nil && len(tree) == 0 {
+			err = fmt.Errorf("spec is empty")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported machine spec format %q", ext)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not parse machine spec %s: %w", path, err)
+	}
+
+	if vm, ok := tree["vm"]; ok {
+		err = parseSizes(vm)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse machine spec %s: %w", path, err)
+		}
+	}
+
+	data, err = json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	// unknown fields are most likely typos
+	spec := &MachineSpec{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(spec)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("could not parse machine spec %s: %w", path, err)
+	}
+
+	if spec.Name == "" {
+		spec.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	if spec.CloudInit != nil && spec.CloudInit.Path == "" {
+		spec.CloudInit.Path = spec.Name + "-cloudinit.iso"
+	}
+
+	spec.resolvePaths(filepath.Dir(path))
+
+	return spec, nil
+}
+
+// NewMachine creates the disk images and cloud-init disk of the spec and
+// returns the machine, ready to be started.
+func (s *MachineSpec) NewMachine(ctx context.Context, opts ...Option) (Machine, error) {
+	config, err := copyConfig(s.VM)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, image := range s.Images {
+		err := createImage(image)
+		if err != nil {
+			return nil, err
+		}
+
+		readonly := image.Readonly
+		config.Disks = appendDevice(config.Disks, api.DiskConfig{
+			Path:     image.Path,
+			Readonly: &readonly,
+		})
+	}
+
+	if s.CloudInit != nil {
+		c := s.CloudInit
+
+		err := createCloudInitDisk(c.Path, c.Hostname, c.Mac, c.CIDR, c.Gateway, c.Username, c.Password)
+		if err != nil {
+			return nil, fmt.Errorf("could not create cloud-init disk: %w", err)
+		}
+
+		readonly := true
+		config.Disks = appendDevice(config.Disks, api.DiskConfig{
+			Path:     c.Path,
+			Readonly: &readonly,
+		})
+	}
+
+	shares := []Option{}
+	for _, share := range s.Shares {
+		shares = append(shares, WithShare(share.Tag, share.Path))
+	}
+
+	return NewMachine(ctx, config, append(shares, opts...)...)
+}
+
+func (s *MachineSpec) resolvePaths(dir string) {
+	resolve := func(path *string) {
+		if path != nil && *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+
+	vm := &s.VM
+	resolve(vm.Payload.Kernel)
+	resolve(vm.Payload.Firmware)
+	resolve(vm.Payload.Initramfs)
+
+	if vm.Disks != nil {
+		for i := range *vm.Disks {
+			disk := &(*vm.Disks)[i]
+			resolve(&disk.Path)
+			resolve(disk.VhostSocket)
+		}
+	}
+
+	if vm.Pmem != nil {
+		for i := range *vm.Pmem {
+			resolve(&(*vm.Pmem)[i].File)
+		}
+	}
+
+	if vm.Fs != nil {
+		for i := range *vm.Fs {
+			resolve(&(*vm.Fs)[i].Socket)
+		}
+	}
+
+	if vm.Memory != nil && vm.Memory.Zones != nil {
+		for i := range *vm.Memory.Zones {
+			resolve((*vm.Memory.Zones)[i].File)
+		}
+	}
+
+	for _, console := range []*api.ConsoleConfig{vm.Serial, vm.Console} {
+		if console != nil {
+			resolve(console.File)
+			resolve(console.Socket)
+		}
+	}
+
+	if vm.DebugConsole != nil {
+		resolve(vm.DebugConsole.File)
+	}
+
+	if vm.Vsock != nil {
+		resolve(&vm.Vsock.Socket)
+	}
+
+	if vm.Tpm != nil {
+		resolve(&vm.Tpm.Socket)
+	}
+
+	for i := range s.Images {
+		resolve(&s.Images[i].Path)
+		resolve(&s.Images[i].Source)
+	}
+
+	if s.CloudInit != nil {
+		resolve(&s.CloudInit.Path)
+	}
+
+	for i := range s.Shares {
+		resolve(&s.Shares[i].Path)
+	}
+}
+
+// interpolate replaces the variable references in all strings of a yaml or
+// json spec.
+func interpolate(tree map[string]any, overrides map[string]string) error {
+	// empty or comment only yaml and json null decode to a nil map
+	if tree == nil {
+		return fmt.Errorf("spec is empty")
+	}
+
+	variables := map[string]string{}
+	if defaults, ok := tree[variablesKey].(map[string]any); ok {
+		for name, value := range defaults {
+			variables[name] = fmt.Sprint(value)
+		}
+	}
+
+	for name, value := range overrides {
+		variables[name] = value
+	}
+
+	tree[variablesKey] = variables
+
+	errs := []error{}
+	var walk func(value any) any
+	walk = func(value any) any {
+		switch v := value.(type) {
+		case string:
+			resolved := variablePattern.ReplaceAllStringFunc(v, func(match string) string {
+				if strings.HasPrefix(match, "$$") {
+					return match[1:]
+				}
+
+				parts := variablePattern.FindStringSubmatch(match)
+				if parts[1] == "env" {
+					value, ok := os.LookupEnv(parts[2])
+					if !ok {
+						errs = append(errs, fmt.Errorf("environment variable %s is not set", parts[2]))
+					}
+
+					return value
+				}
+
+				value, ok := variables[parts[2]]
+				if !ok {
+					errs = append(errs, fmt.Errorf("variable %s is not defined", parts[2]))
+				}
+
+				return value
+			})
+
+			match := variablePattern.FindStringIndex(v)
+			if match != nil && match[0] == 0 && match[1] == len(v) && !strings.HasPrefix(v, "$$") {
+				return reference(resolved)
+			}
+
+			return resolved
+		case map[string]any:
+			for key, item := range v {
+				v[key] = walk(item)
+			}
+		case []any:
+			for i, item := range v {
+				v[i] = walk(item)
+			}
+		}
+
+		return value
+	}
+
+	for key, value := range tree {
+		if key != variablesKey {
+			tree[key] = walk(value)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// convertReferences converts the single references in value to the type of
+// the field t they are assigned to. References that are not numbers or bools,
+// or that are assigned to unknown fields, stay strings.
+func convertReferences(value any, t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch v := value.(type) {
+	case reference:
+		return convertReference(string(v), t)
+	case map[string]any:
+		fields := map[string]reflect.Type{}
+		switch t.Kind() {
+		case reflect.Struct:
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if name == "" {
+					name = field.Name
+				}
+
+				fields[name] = field.Type
+			}
+		case reflect.Map:
+			for key := range v {
+				fields[key] = t.Elem()
+			}
+		}
+
+		for key, item := range v {
+			if field, ok := fields[key]; ok {
+				v[key] = convertReferences(item, field)
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, item := range v {
+				v[i] = convertReferences(item, t.Elem())
+			}
+		}
+	}
+
+	return value
+}
+
+// convertReference converts a reference to a bool or number when the field it
+// is assigned to has that type.
+func convertReference(s string, t reflect.Type) any {
+	// types like units.Size parse strings themselves
+	if reflect.PointerTo(t).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		// sizes like 1GiB are left to parseSizes
+		if _, err := strconv.ParseFloat(s, 64); err == nil && json.Valid([]byte(s)) {
+			return json.Number(s)
+		}
+	}
+
+	return s
+}
+
+// decodeHCL evaluates the attributes of a hcl spec, with the variables and
+// the environment available as var and env.
+func decodeHCL(data []byte, filename string, overrides map[string]string) (map[string]any, error) {
+	file, diags := hclsyntax.ParseConfig(data, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	body := file.Body.(*hclsyntax.Body)
+	if len(body.Blocks) > 0 {
+		block := body.Blocks[0]
+		return nil, fmt.Errorf("%s: blocks are not supported, use %s = { ... } instead", block.Range(), block.Type)
+	}
+
+	env := map[string]cty.Value{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		env[name] = cty.StringVal(value)
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"env": cty.ObjectVal(env),
+		},
+	}
+
+	variables := map[string]cty.Value{}
+	if attr, ok := body.Attributes[variablesKey]; ok {
+		value, diags := attr.Expr.Value(ctx)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		if !value.Type().IsObjectType() && !value.Type().IsMapType() {
+			return nil, fmt.Errorf("%s: variables must be an object", attr.Range())
+		}
+
+		for name, value := range value.AsValueMap() {
+			variables[name] = value
+		}
+	}
+
+	for name, value := range overrides {
+		override := cty.StringVal(value)
+
+		// overrides take the type of their default, so numbers stay numbers
+		if def, ok := variables[name]; ok && def.Type().IsPrimitiveType() {
+			converted, err := convert.Convert(override, def.Type())
+			if err != nil {
+				return nil, fmt.Errorf("variable %s: %w", name, err)
+			}
+
+			override = converted
+		}
+
+		variables[name] = override
+	}
+
+	ctx.Variables["var"] = cty.ObjectVal(variables)
+
+	tree := map[string]any{}
+	for name, attr := range body.Attributes {
+		value, diags := attr.Expr.Value(ctx)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		// the spec keeps the variables as strings
+		if name == variablesKey {
+			strs := map[string]cty.Value{}
+			for name, variable := range variables {
+				str, err := convert.Convert(variable, cty.String)
+				if err != nil {
+					return nil, fmt.Errorf("variable %s: %w", name, err)
+				}
+
+				strs[name] = str
+			}
+
+			value = cty.ObjectVal(strs)
+		}
+
+		data, err := ctyjson.Marshal(value, value.Type())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", attr.Range(), err)
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		var v any
+		err = decoder.Decode(&v)
+		if err != nil {
+			return nil, err
+		}
+
+		tree[name] = v
+	}
+
+	return tree, nil
+}
+
+// parseSizes converts the sizes written as strings in the vm config to bytes.
+func parseSizes(vm any) error {
+	errs := []error{}
+	for _, path := range sizePaths {
+		errs = append(errs, parseSize(vm, path, "vm"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseSize converts the size at path in value, name is the path so far and
+// is used in errors.
+func parseSize(value any, path []string, name string) error {
+	switch v := value.(type) {
+	case map[string]any:
+		item, ok := v[path[0]]
+		if !ok {
+			return nil
+		}
+
+		name = name + "." + path[0]
+		if len(path) > 1 {
+			return parseSize(item, path[1:], name)
+		}
+
+		s, ok := item.(string)
+		if !ok {
+			return nil
+		}
+
+		size, err := units.ParseSize(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		v[path[0]] = size
+	case []any:
+		if path[0] != "[]" {
+			return nil
+		}
+
+		errs := []error{}
+		for i, item := range v {
+			errs = append(errs, parseSize(item, path[1:], fmt.Sprintf("%s[%d]", name, i)))
+		}
+
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// createImage creates the disk image if it does not exist and grows it to its
+// size.
+func createImage(image ImageSpec) error {
+	_, err := os.Stat(image.Path)
+	switch {
+	case err == nil:
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	case image.Source != "":
+		err = copyFile(image.Source, image.Path)
+		if err != nil {
+			return fmt.Errorf("could not create image %s: %w", image.Path, err)
+		}
+	case image.Size > 0:
+		err = os.MkdirAll(filepath.Dir(image.Path), 0755)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(image.Path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("could not create image %s: %w", image.Path, err)
+		}
+		f.Close()
+	default:
+		return fmt.Errorf("image %s does not exist and has no source or size", image.Path)
+	}
+
+	if image.Size <= 0 {
+		return nil
+	}
+
+	fi, err := os.Stat(image.Path)
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() >= int64(image.Size) {
+		return nil
+	}
+
+	return os.Truncate(image.Path, int64(image.Size))
+}
+
+func copyFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	err = os.MkdirAll(filepath.Dir(destination), 0755)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		os.Remove(destination)
+		return err
+	}
+
+	return out.Close()
+}
+
+// copyConfig returns a deep copy of the config.
+func copyConfig(config api.VmConfig) (api.VmConfig, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return api.VmConfig{}, err
+	}
+
+	copied := api.VmConfig{}
+	err = json.Unmarshal(data, &copied)
+	if err != nil {
+		return api.VmConfig{}, err
+	}
+
+	return copied, nil
+}
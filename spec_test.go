@@ -0,0 +1,326 @@
+package sdk
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/units"
+)
+
+func TestReadMachineSpec(t *testing.T) {
+	t.Setenv("SPEC_TEST_USER", "jumppad")
+
+	tests := []struct {
+		name      string
+		file      string
+		data      string
+		variables map[string]string
+		want      func(dir string) *MachineSpec
+		wantErr   bool
+	}{
+		{
+			name: "yaml",
+			file: "microvm.yaml",
+			data: `
+vm:
+  payload:
+    kernel: files/vmlinuz
+  cpus:
+    boot_vcpus: 2
+    max_vcpus: 2
+  memory:
+    size: 1GiB
+  disks:
+    - path: /images/noble.raw
+`,
+			want: func(dir string) *MachineSpec {
+				return &MachineSpec{
+					Name: "microvm",
+					VM: api.VmConfig{
+						Payload: api.PayloadConfig{Kernel: ptr(filepath.Join(dir, "files/vmlinuz"))},
+						Cpus:    &api.CpusConfig{BootVcpus: 2, MaxVcpus: 2},
+						Memory:  &api.MemoryConfig{Size: units.GiB},
+						Disks:   &[]api.DiskConfig{{Path: "/images/noble.raw"}},
+					},
+				}
+			},
+		},
+		{
+			name: "json",
+			file: "machine.json",
+			data: `{
+  "name": "microvm",
+  "vm": {
+    "payload": {"kernel": "files/vmlinuz"},
+    "cpus": {"boot_vcpus": 2, "max_vcpus": 2},
+    "memory": {"size": "512M"}
+  }
+}`,
+			want: func(dir string) *MachineSpec {
+				return &MachineSpec{
+					Name: "microvm",
+					VM: api.VmConfig{
+						Payload: api.PayloadConfig{Kernel: ptr(filepath.Join(dir, "files/vmlinuz"))},
+						Cpus:    &api.CpusConfig{BootVcpus: 2, MaxVcpus: 2},
+						Memory:  &api.MemoryConfig{Size: 512 * units.MiB},
+					},
+				}
+			},
+		},
+		{
+			name: "hcl",
+			file: "machine.hcl",
+			data: `
+name = "microvm"
+
+variables = {
+  cpus = 2
+}
+
+vm = {
+  payload = { kernel = "files/vmlinuz" }
+  cpus    = { boot_vcpus = var.cpus, max_vcpus = var.cpus }
+  memory  = { size = "1G" }
+}
+`,
+			variables: map[string]string{"cpus": "4"},
+			want: func(dir string) *MachineSpec {
+				return &MachineSpec{
+					Name:      "microvm",
+					Variables: map[string]string{"cpus": "4"},
+					VM: api.VmConfig{
+						Payload: api.PayloadConfig{Kernel: ptr(filepath.Join(dir, "files/vmlinuz"))},
+						Cpus:    &api.CpusConfig{BootVcpus: 4, MaxVcpus: 4},
+						Memory:  &api.MemoryConfig{Size: units.GiB},
+					},
+				}
+			},
+		},
+		{
+			name: "interpolation",
+			file: "microvm.yaml",
+			data: `
+variables:
+  cpus: 2
+  shared: true
+  memory: 2G
+  image: noble
+vm:
+  cpus:
+    boot_vcpus: ${var.cpus}
+    max_vcpus: ${var.cpus}
+  memory:
+    size: ${var.memory}
+    shared: ${var.shared}
+  disks:
+    - path: /images/${var.image}.raw
+cloud_init:
+  hostname: ${var.cpus}
+  username: ${env.SPEC_TEST_USER}
+  password: $${var.password}
+`,
+			variables: map[string]string{"cpus": "4"},
+			want: func(dir string) *MachineSpec {
+				return &MachineSpec{
+					Name: "microvm",
+					Variables: map[string]string{
+						"cpus":   "4",
+						"shared": "true",
+						"memory": "2G",
+						"image":  "noble",
+					},
+					VM: api.VmConfig{
+						Cpus:   &api.CpusConfig{BootVcpus: 4, MaxVcpus: 4},
+						Memory: &api.MemoryConfig{Size: 2 * units.GiB, Shared: ptr(true)},
+						Disks:  &[]api.DiskConfig{{Path: "/images/noble.raw"}},
+					},
+					CloudInit: &CloudInitSpec{
+						Path:     filepath.Join(dir, "microvm-cloudinit.iso"),
+						Hostname: "4",
+						Username: "jumppad",
+						Password: "${var.password}",
+					},
+				}
+			},
+		},
+		{
+			name: "relative paths",
+			file: "microvm.yaml",
+			data: `
+vm:
+  payload:
+    kernel: /boot/vmlinuz
+    initramfs: files/initrd
+  serial:
+    mode: File
+    file: logs/serial.log
+images:
+  - path: files/data.raw
+    source: ../base.raw
+shares:
+  - tag: data
+    path: shared
+`,
+			want: func(dir string) *MachineSpec {
+				return &MachineSpec{
+					Name: "microvm",
+					VM: api.VmConfig{
+						Payload: api.PayloadConfig{
+							Kernel:    ptr("/boot/vmlinuz"),
+							Initramfs: ptr(filepath.Join(dir, "files/initrd")),
+						},
+						Serial: &api.ConsoleConfig{Mode: "File", File: ptr(filepath.Join(dir, "logs/serial.log"))},
+					},
+					Images: []ImageSpec{{
+						Path:   filepath.Join(dir, "files/data.raw"),
+						Source: filepath.Join(filepath.Dir(dir), "base.raw"),
+					}},
+					Shares: []ShareSpec{{Tag: "data", Path: filepath.Join(dir, "shared")}},
+				}
+			},
+		},
+		{
+			name: "sizes",
+			file: "microvm.yaml",
+			data: `
+vm:
+  memory:
+    size: 0
+    hotplug_size: 4G
+    zones:
+      - id: mem0
+        size: 512M
+        hugepage_size: 2M
+  balloon:
+    size: 256M
+  pmem:
+    - file: /images/pmem.raw
+      size: 1G
+  sgx_epc:
+    - id: epc0
+      size: 64M
+images:
+  - path: /images/data.raw
+    size: 10G
+`,
+			want: func(dir string) *MachineSpec {
+				return &MachineSpec{
+					Name: "microvm",
+					VM: api.VmConfig{
+						Memory: &api.MemoryConfig{
+							HotplugSize: ptr[int64](4 * units.GiB),
+							Zones: &[]api.MemoryZoneConfig{{
+								Id:           "mem0",
+								Size:         512 * units.MiB,
+								HugepageSize: ptr[int64](2 * units.MiB),
+							}},
+						},
+						Balloon: &api.BalloonConfig{Size: 256 * units.MiB},
+						Pmem:    &[]api.PmemConfig{{File: "/images/pmem.raw", Size: ptr[int64](units.GiB)}},
+						SgxEpc:  &[]api.SgxEpcConfig{{Id: "epc0", Size: 64 * units.MiB}},
+					},
+					Images: []ImageSpec{{Path: "/images/data.raw", Size: units.Size(10 * units.GiB)}},
+				}
+			},
+		},
+		{
+			name: "size outside memory",
+			file: "microvm.yaml",
+			data: `
+vm:
+  disks:
+    - path: /images/noble.raw
+      rate_limiter_config:
+        ops:
+          size: 1M
+          refill_time: 100
+`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid size",
+			file:    "microvm.yaml",
+			data:    "vm:\n  memory:\n    size: lots\n",
+			wantErr: true,
+		},
+		{
+			name:    "undefined variable",
+			file:    "microvm.yaml",
+			data:    "vm:\n  cpus:\n    boot_vcpus: ${var.cpus}\n",
+			wantErr: true,
+		},
+		{
+			name:    "unset environment variable",
+			file:    "microvm.yaml",
+			data:    "name: ${env.SPEC_TEST_UNSET}\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			file:    "microvm.yaml",
+			data:    "vm:\n  cpu:\n    boot_vcpus: 2\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			file:    "microvm.yaml",
+			data:    "# nothing\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty hcl",
+			file:    "microvm.hcl",
+			data:    "",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			file:    "microvm.toml",
+			data:    "name = \"microvm\"\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "spec")
+			err := os.Mkdir(dir, 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, tt.file)
+			err = os.WriteFile(path, []byte(tt.data), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ReadMachineSpec(path, tt.variables)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ReadMachineSpec() = %+v, want error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ReadMachineSpec() returned error: %s", err)
+			}
+
+			want := tt.want(dir)
+			if want.Variables == nil {
+				want.Variables = map[string]string{}
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				have, _ := json.Marshal(got)
+				want, _ := json.Marshal(want)
+				t.Errorf("ReadMachineSpec() = %s, want %s", have, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// State is the lifecycle state of a machine, covering both the vmm process
+// and the vm it runs.
+type State string
+
+const (
+	StateNotStarted   State = "NotStarted"
+	StateVMMStarting  State = "VMMStarting"
+	StateCreated      State = "Created"
+	StateBooting      State = "Booting"
+	StateRunning      State = "Running"
+	StatePaused       State = "Paused"
+	StateShuttingDown State = "ShuttingDown"
+	StateShutdown     State = "Shutdown"
+	StateExited       State = "Exited"
+	StateFailed       State = "Failed"
+)
+
+const subscriberBuffer = 64
+
+// transitions lists the states a machine can move to from each state.
+// Exited and Failed are final.
+var transitions = map[State][]State{
+	StateNotStarted:   {StateVMMStarting, StateExited, StateFailed},
+	StateVMMStarting:  {StateCreated, StateBooting, StatePaused, StateRunning, StateExited, StateFailed},
+	StateCreated:      {StateBooting, StateShuttingDown, StateExited, StateFailed},
+	StateBooting:      {StateRunning, StateExited, StateFailed},
+	StateRunning:      {StatePaused, StateBooting, StateShuttingDown, StateShutdown, StateExited, StateFailed},
+	StatePaused:       {StateRunning, StateBooting, StateShuttingDown, StateExited, StateFailed},
+	StateShuttingDown: {StateShutdown, StateRunning, StatePaused, StateCreated, StateExited, StateFailed},
+	StateShutdown:     {StateBooting, StateShuttingDown, StateExited, StateFailed},
+	StateExited:       {},
+	StateFailed:       {},
+}
+
+// StateEvent is sent to subscribers every time the state of a machine changes.
+type StateEvent struct {
+	From State
+	To   State
+	Time time.Time
+	// Err is the error that caused the machine to fail or exit, if any.
+	Err error
+}
+
+// Final reports whether the machine can not leave the state anymore.
+func (s State) Final() bool {
+	return len(transitions[s]) == 0
+}
+
+// CanTransition reports whether a machine can move from s to the given state.
+func (s State) CanTransition(to State) bool {
+	return slices.Contains(transitions[s], to)
+}
+
+// State returns the current state of the machine.
+func (m *MachineImpl) State() State {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	return m.state
+}
+
+// Subscribe returns a channel that receives every state change of the
+// machine. The channel is closed when the context is cancelled, the machine
+// reaches a final state or it is deleted. Events are dropped when the subscriber does
+// not keep up.
+func (m *MachineImpl) Subscribe(ctx context.Context) <-chan StateEvent {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	ch := make(chan StateEvent, subscriberBuffer)
+	if m.state.Final() {
+		close(ch)
+		return ch
+	}
+
+	m.subscribers[ch] = struct{}{}
+
+	go func() {
+		// the final state closes the channel as well, the exit is only waited
+		// for so the goroutine does not outlive the machine
+		select {
+		case <-ctx.Done():
+		case <-m.exitCh:
+		}
+
+		m.stateMu.Lock()
+		defer m.stateMu.Unlock()
+
+		if _, ok := m.subscribers[ch]; ok {
+			delete(m.subscribers, ch)
+			close(ch)
+		}
+	}()
+
+	return ch
+}
+
+// requireState returns ErrInvalidState when the machine is not in one of the
+// allowed states.
+func (m *MachineImpl) requireState(operation string, allowed ...State) error {
+	state := m.State()
+	if slices.Contains(allowed, state) {
+		return nil
+	}
+
+	return fmt.Errorf("could not %s in state %s: %w", operation, state, ErrInvalidState)
+}
+
+// setState moves the machine to a new state and notifies subscribers. Illegal
+// transitions are logged and ignored.
+func (m *MachineImpl) setState(to State, err error) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	from := m.state
+	if from == to {
+		return
+	}
+
+	if !from.CanTransition(to) {
+		if !from.Final() {
+			m.logger.Printf("ignoring illegal state transition from %s to %s", from, to)
+		}
+
+		return
+	}
+
+	m.state = to
+	event := StateEvent{
+		From: from,
+		To:   to,
+		Time: time.Now(),
+		Err:  err,
+	}
+
+	for ch := range m.subscribers {
+		select {
+		case ch <- event:
+		default:
+			m.logger.Printf("dropping state event %s for slow subscriber", to)
+		}
+
+		if to.Final() {
+			delete(m.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/jumppad-labs/cloudhypervisor-go-sdk/api"
+)
+
+const (
+	defaultGracePeriod   = 10 * time.Second
+	shutdownPollInterval = 500 * time.Millisecond
+)
+
+// StopStage is the step of Stop that got the vmm to exit.
+type StopStage string
+
+const (
+	// StopNone means the vmm had already exited.
+	StopNone StopStage = ""
+	// StopPowerButton means the guest shut down after an acpi power button
+	// event.
+	StopPowerButton StopStage = "PowerButton"
+	// StopShutdown means the vm and vmm were shut down through the api.
+	StopShutdown StopStage = "Shutdown"
+	// StopTerminate means the vmm exited after SIGTERM.
+	StopTerminate StopStage = "SIGTERM"
+	// StopKill means the vmm had to be killed.
+	StopKill StopStage = "SIGKILL"
+)
+
+// StopOptions configures Stop.
+type StopOptions struct {
+	// GracePeriod is how long every stage waits for the vmm to exit before
+	// Stop escalates to the next one, it defaults to 10 seconds.
+	GracePeriod time.Duration
+}
+
+// Stop shuts the machine down, escalating until the vmm has exited. A running
+// guest first gets an acpi power button event so it can shut down cleanly,
+// then the vm and vmm are shut down through the api, then the vmm is sent
+// SIGTERM and finally SIGKILL. It returns the stage that completed the stop.
+func (m *MachineImpl) Stop(ctx context.Context, opts StopOptions) (StopStage, error) {
+	pid := m.vmmPID()
+	if pid == 0 {
+		return StopNone, fmt.Errorf("machine is not running")
+	}
+
+	grace := opts.GracePeriod
+	if grace <= 0 {
+		grace = defaultGracePeriod
+	}
+
+	if m.exited() {
+		return StopNone, nil
+	}
+
+	if m.State() == StateRunning && m.stopWithPowerButton(ctx, grace) {
+		return StopPowerButton, nil
+	}
+
+	if ctx.Err() != nil {
+		return StopNone, ctx.Err()
+	}
+
+	if m.stopWithShutdown(ctx, grace) {
+		return StopShutdown, nil
+	}
+
+	if ctx.Err() != nil {
+		return StopNone, ctx.Err()
+	}
+
+	err := m.signal(syscall.SIGTERM)
+	if err != nil {
+		m.logger.Printf("could not terminate vmm: %s", err)
+	} else if m.waitExited(ctx, grace) {
+		return StopTerminate, nil
+	}
+
+	err = killProcess(pid)
+	if err != nil {
+		return StopNone, fmt.Errorf("could not kill vmm: %w", err)
+	}
+
+	if !m.waitExited(ctx, grace) {
+		return StopNone, fmt.Errorf("vmm %d did not exit after SIGKILL", pid)
+	}
+
+	return StopKill, nil
+}
+
+// stopWithPowerButton presses the power button and waits for the guest to shut
+// down and the vmm to exit.
+func (m *MachineImpl) stopWithPowerButton(ctx context.Context, grace time.Duration) bool {
+	err := m.PowerButton(ctx)
+	if err != nil {
+		m.logger.Printf("could not press power button: %s", err)
+		return false
+	}
+
+	if !m.waitForShutdown(ctx, grace) {
+		m.logger.Printf("guest did not shut down within %s", grace)
+		return false
+	}
+
+	if m.exited() {
+		return true
+	}
+
+	// the guest is down but the vmm is still around
+	apiCtx, cancel := context.WithTimeout(ctx, grace)
+	defer cancel()
+
+	err = m.shutdownVMM(apiCtx)
+	if err != nil {
+		m.logger.Println(err)
+		return false
+	}
+
+	return m.waitExited(ctx, grace)
+}
+
+// stopWithShutdown shuts the vm and vmm down through the api and waits for the
+// vmm to exit.
+func (m *MachineImpl) stopWithShutdown(ctx context.Context, grace time.Duration) bool {
+	apiCtx, cancel := context.WithTimeout(ctx, grace)
+	defer cancel()
+
+	err := m.Shutdown(apiCtx)
+	if errors.Is(err, ErrInvalidState) {
+		// there is no vm to shut down
+		err = m.shutdownVMM(apiCtx)
+	}
+
+	if err != nil {
+		m.logger.Println(err)
+		return false
+	}
+
+	return m.waitExited(ctx, grace)
+}
+
+// waitForShutdown waits up to timeout for the guest to shut down, watching the
+// events of the vmm and polling the vm info for vmms without events.
+func (m *MachineImpl) waitForShutdown(ctx context.Context, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	events := m.Subscribe(ctx)
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if m.State() == StateShutdown {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-m.exitCh:
+			return true
+		case <-events:
+		case <-ticker.C:
+			info, err := m.Info(ctx)
+			if err == nil && info.State == api.Shutdown {
+				return true
+			}
+		}
+	}
+}
+
+// waitExited waits up to timeout for the vmm to exit.
+func (m *MachineImpl) waitExited(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return false
+	case <-m.exitCh:
+		return true
+	}
+}
+
+func (m *MachineImpl) exited() bool {
+	select {
+	case <-m.exitCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *MachineImpl) signal(sig os.Signal) error {
+	p, err := os.FindProcess(m.vmmPID())
+	if err != nil {
+		return err
+	}
+
+	err = p.Signal(sig)
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,431 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = time.Minute
+	killTimeout       = 10 * time.Second
+)
+
+// RestartMode decides when a supervised machine is restarted.
+type RestartMode string
+
+const (
+	// RestartNever never restarts the machine.
+	RestartNever RestartMode = "never"
+	// RestartOnFailure restarts the machine when the vmm crashes or the guest
+	// panics, but not when the guest shuts down.
+	RestartOnFailure RestartMode = "on-failure"
+	// RestartAlways restarts the machine whenever it exits, until the
+	// supervisor is stopped.
+	RestartAlways RestartMode = "always"
+)
+
+// RestartPolicy configures how a supervisor restarts its machine.
+type RestartPolicy struct {
+	Mode RestartMode
+	// MaxRetries is the number of consecutive restarts after which the
+	// supervisor gives up, zero means no limit.
+	MaxRetries int
+	// Backoff is the delay before the first restart, it doubles with every
+	// consecutive restart up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// ExitReason describes why a supervised machine exited.
+type ExitReason string
+
+const (
+	ExitNone          ExitReason = ""
+	ExitGuestShutdown ExitReason = "GuestShutdown"
+	ExitGuestPanic    ExitReason = "GuestPanic"
+	ExitVMMCrash      ExitReason = "VMMCrash"
+	ExitStopped       ExitReason = "Stopped"
+)
+
+// MachineFactory creates the machine a supervisor runs, it is called again
+// for every restart.
+type MachineFactory func(ctx context.Context) (Machine, error)
+
+// SupervisorStatus is a snapshot of the history of a supervised machine.
+type SupervisorStatus struct {
+	// Restarts is the total number of restarts.
+	Restarts int
+	// Reboots is the number of times the guest rebooted inside the vmm,
+	// which does not need a restart.
+	Reboots int
+	// WatchdogResets is the number of those reboots that were caused by the
+	// watchdog of the guest expiring.
+	WatchdogResets int
+	LastExit       ExitReason
+	LastErr        error
+	LastExitAt     time.Time
+}
+
+// Supervisor runs a machine and restarts it according to a restart policy.
+type Supervisor struct {
+	factory MachineFactory
+	policy  RestartPolicy
+	logger  *log.Logger
+
+	mu      sync.Mutex
+	machine Machine
+	status  SupervisorStatus
+	cancel  context.CancelFunc
+	doneCh  chan struct{}
+	err     error
+}
+
+// NewSupervisor creates a supervisor for the machines created by factory.
+func NewSupervisor(factory MachineFactory, policy RestartPolicy, logger *log.Logger) *Supervisor {
+	if policy.Mode == "" {
+		policy.Mode = RestartNever
+	}
+
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultBackoff
+	}
+
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultMaxBackoff
+	}
+
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return &Supervisor{
+		factory: factory,
+		policy:  policy,
+		logger:  logger,
+		doneCh:  make(chan struct{}),
+	}
+}
+
+// Start starts the first machine and supervises it in the background.
+func (s *Supervisor) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("supervisor already started")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	machine, err := s.start(ctx)
+	if err != nil {
+		cancel()
+		s.finish(err)
+		return err
+	}
+
+	go s.supervise(ctx, machine)
+
+	return nil
+}
+
+// Machine returns the machine that is currently running, or nil once the
+// supervisor has stopped and deleted it.
+func (s *Supervisor) Machine() Machine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.machine
+}
+
+// Status returns the restart history of the supervised machine.
+func (s *Supervisor) Status() SupervisorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.status
+}
+
+// Stop stops supervising, shuts the current machine down and deletes it.
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return fmt.Errorf("supervisor not started")
+	}
+
+	cancel()
+
+	err := s.release(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.Wait(ctx)
+}
+
+// Wait blocks until the supervisor gives up or is stopped. It returns the
+// error of the last exit when the supervisor gave up.
+func (s *Supervisor) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.doneCh:
+		return s.err
+	}
+}
+
+func (s *Supervisor) start(ctx context.Context) (Machine, error) {
+	machine, err := s.factory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.machine = machine
+	s.mu.Unlock()
+
+	events := machine.Events(ctx)
+	go func() {
+		for event := range events {
+			s.mu.Lock()
+			switch {
+			case event.Source == EventSourceVM && event.Type == EventRebooted:
+				s.status.Reboots++
+			case event.Type == EventWatchdogReset:
+				s.status.WatchdogResets++
+			}
+			s.mu.Unlock()
+		}
+	}()
+
+	err = machine.Start(ctx)
+	if err != nil {
+		return nil, errors.Join(err, s.release(ctx))
+	}
+
+	return machine, nil
+}
+
+func (s *Supervisor) supervise(ctx context.Context, machine Machine) {
+	retries := 0
+	backoff := s.policy.Backoff
+
+	for {
+		reason, err := waitForExit(ctx, machine)
+
+		s.mu.Lock()
+		s.status.LastExit = reason
+		s.status.LastErr = err
+		s.status.LastExitAt = time.Now()
+		s.mu.Unlock()
+
+		if reason == ExitStopped {
+			s.releaseLast(ctx)
+			s.finish(nil)
+			return
+		}
+
+		s.logger.Printf("machine %s exited: %s", machine.ID(), reason)
+
+		// a machine that kept running for a while starts over with the backoff
+		if time.Since(machine.StartedAt()) > s.policy.MaxBackoff {
+			retries = 0
+			backoff = s.policy.Backoff
+		}
+
+		if !s.shouldRestart(reason) {
+			s.releaseLast(ctx)
+			s.finish(err)
+			return
+		}
+
+		if s.policy.MaxRetries > 0 && retries >= s.policy.MaxRetries {
+			s.releaseLast(ctx)
+			s.finish(fmt.Errorf("giving up after %d restarts: %w", retries, err))
+			return
+		}
+
+		// release the exited machine, this also makes sure a panicked guest
+		// does not keep its vmm around
+		s.releaseLast(ctx)
+
+		next, err := s.restart(ctx, &retries, &backoff)
+		if err != nil {
+			s.finish(err)
+			return
+		}
+
+		if next == nil {
+			s.finish(nil)
+			return
+		}
+
+		machine = next
+	}
+}
+
+// restart starts a new machine, retrying with backoff until it succeeds, the
+// retries run out or the context is cancelled, in which case it returns nil.
+func (s *Supervisor) restart(ctx context.Context, retries *int, backoff *time.Duration) (Machine, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-time.After(*backoff):
+		}
+
+		*backoff = min(*backoff*2, s.policy.MaxBackoff)
+		*retries++
+
+		machine, err := s.start(ctx)
+
+		s.mu.Lock()
+		s.status.Restarts++
+		s.mu.Unlock()
+
+		if err == nil {
+			return machine, nil
+		}
+
+		s.logger.Printf("could not restart machine: %s", err)
+
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+
+		if s.policy.MaxRetries > 0 && *retries >= s.policy.MaxRetries {
+			return nil, fmt.Errorf("giving up after %d restarts: %w", *retries, err)
+		}
+	}
+}
+
+// release deletes the current machine, the supervisor and Stop both release
+// it, whichever comes first deletes it.
+func (s *Supervisor) release(ctx context.Context) error {
+	s.mu.Lock()
+	machine := s.machine
+	s.machine = nil
+	s.mu.Unlock()
+
+	if machine == nil {
+		return nil
+	}
+
+	err := machine.Delete(context.WithoutCancel(ctx))
+	if err != nil {
+		return fmt.Errorf("could not delete machine %s: %w", machine.ID(), err)
+	}
+
+	return nil
+}
+
+// releaseLast releases the current machine and logs when that fails, the
+// supervisor has no caller to return the error to.
+func (s *Supervisor) releaseLast(ctx context.Context) {
+	err := s.release(ctx)
+	if err != nil {
+		s.logger.Print(err)
+	}
+}
+
+func (s *Supervisor) shouldRestart(reason ExitReason) bool {
+	switch s.policy.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return reason == ExitGuestPanic || reason == ExitVMMCrash
+	}
+
+	return false
+}
+
+func (s *Supervisor) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.doneCh:
+		return
+	default:
+	}
+
+	s.err = err
+	close(s.doneCh)
+}
+
+// waitForExit waits for the machine to exit and classifies the exit.
+func waitForExit(ctx context.Context, machine Machine) (ExitReason, error) {
+	err := machine.Wait(ctx)
+
+	switch {
+	case ctx.Err() != nil:
+		return ExitStopped, nil
+	case errors.Is(err, ErrGuestPanicked):
+		return ExitGuestPanic, err
+	case err != nil:
+		return ExitVMMCrash, err
+	}
+
+	return ExitGuestShutdown, nil
+}
+
+// stopMachine shuts the machine down and kills the vmm when it does not exit.
+func stopMachine(ctx context.Context, machine Machine) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), killTimeout)
+	defer cancel()
+
+	pid, err := machine.PID()
+	if err != nil {
+		// the vmm is not running
+		return nil
+	}
+
+	err = machine.Shutdown(ctx)
+	if err == nil && waitForVMMExit(ctx, machine) == nil {
+		return nil
+	}
+
+	return killProcess(pid)
+}
+
+// waitForVMMExit waits until the vmm process of the machine has exited.
+func waitForVMMExit(ctx context.Context, machine Machine) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if _, err := machine.PID(); err != nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func killProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	err = p.Kill()
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+// Package units parses and formats the byte sizes used in vm configs, like
+// 512M or 1GiB.
+package units
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	B   int64 = 1
+	KiB       = 1 << 10
+	MiB       = 1 << 20
+	GiB       = 1 << 30
+	TiB       = 1 << 40
+
+	KB int64 = 1000
+	MB       = 1000 * KB
+	GB       = 1000 * MB
+	TB       = 1000 * GB
+)
+
+// DefaultHugepageSize is the hugepage size cloud-hypervisor uses when none is
+// configured.
+const DefaultHugepageSize = 2 * MiB
+
+// suffixes maps the upper case unit suffixes to their size. Like
+// cloud-hypervisor, K, M, G and T are powers of 1024, the SI units KB, MB, GB
+// and TB are powers of 1000.
+var suffixes = map[string]int64{
+	"":    B,
+	"B":   B,
+	"K":   KiB,
+	"KIB": KiB,
+	"KB":  KB,
+	"M":   MiB,
+	"MIB": MiB,
+	"MB":  MB,
+	"G":   GiB,
+	"GIB": GiB,
+	"GB":  GB,
+	"T":   TiB,
+	"TIB": TiB,
+	"TB":  TB,
+}
+
+// formats are the units FormatSize picks from, binary units are preferred.
+var formats = []struct {
+	size   int64
+	suffix string
+}{
+	{TiB, "TiB"},
+	{GiB, "GiB"},
+	{MiB, "MiB"},
+	{KiB, "KiB"},
+	{TB, "TB"},
+	{GB, "GB"},
+	{MB, "MB"},
+	{KB, "KB"},
+}
+
+// ParseSize parses a size like 512M, 1GiB, 1.5G or 4096 into bytes. The size
+// has to be a whole number of bytes.
+func ParseSize(s string) (int64, error) {
+	trimmed := strings.TrimSpace(s)
+
+	i := strings.IndexFunc(trimmed, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(trimmed)
+	}
+
+	number := trimmed[:i]
+	suffix := strings.ToUpper(strings.TrimSpace(trimmed[i:]))
+
+	multiplier, ok := suffixes[suffix]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	r, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	r.Mul(r, new(big.Rat).SetInt64(multiplier))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("size %q is not a whole number of bytes", s)
+	}
+
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+
+	return r.Num().Int64(), nil
+}
+
+// FormatSize formats bytes with the unit that divides it into the smallest
+// number, e.g. 1GiB, 1536MiB or 2TB. Binary units win a tie.
+func FormatSize(bytes int64) string {
+	best := fmt.Sprintf("%dB", bytes)
+	if bytes == 0 {
+		return best
+	}
+
+	smallest := bytes
+	for _, format := range formats {
+		if bytes%format.size == 0 && abs(bytes/format.size) < abs(smallest) {
+			smallest = bytes / format.size
+			best = fmt.Sprintf("%d%s", smallest, format.suffix)
+		}
+	}
+
+	return best
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+// CheckAligned returns an error when size is not a multiple of align, e.g.
+// the hugepage size backing the memory.
+func CheckAligned(size int64, align int64) error {
+	if align <= 0 {
+		return fmt.Errorf("invalid alignment %d", align)
+	}
+
+	if size%align != 0 {
+		return fmt.Errorf("%s is not a multiple of %s", FormatSize(size), FormatSize(align))
+	}
+
+	return nil
+}
+
+// CheckHugepageSize returns an error when size is not a valid hugepage size.
+func CheckHugepageSize(size int64) error {
+	if size < 4*KiB || size&(size-1) != 0 {
+		return fmt.Errorf("hugepage size %s is not a power of two of at least 4KiB", FormatSize(size))
+	}
+
+	return nil
+}
+
+// Size is a number of bytes that is written as a human readable size, it is
+// used in config files. Plain numbers are read as bytes.
+type Size int64
+
+func (s Size) String() string {
+	return FormatSize(int64(s))
+}
+
+func (s Size) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Size) UnmarshalText(text []byte) error {
+	bytes, err := ParseSize(string(text))
+	if err != nil {
+		return err
+	}
+
+	*s = Size(bytes)
+	return nil
+}
+
+func (s *Size) UnmarshalJSON(data []byte) error {
+	var bytes int64
+	if err := json.Unmarshal(data, &bytes); err == nil {
+		*s = Size(bytes)
+		return nil
+	}
+
+	var text string
+	err := json.Unmarshal(data, &text)
+	if err != nil {
+		return fmt.Errorf("size must be a number or a string: %s", data)
+	}
+
+	return s.UnmarshalText([]byte(text))
+}
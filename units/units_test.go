@@ -0,0 +1,184 @@
+package units
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "4096", want: 4096},
+		{in: "0", want: 0},
+		{in: "1B", want: 1},
+		{in: "1K", want: KiB},
+		{in: "1KiB", want: KiB},
+		{in: "1KB", want: 1000},
+		{in: "1kb", want: 1000},
+		{in: "512M", want: 512 * MiB},
+		{in: "512m", want: 512 * MiB},
+		{in: "2MB", want: 2 * MB},
+		{in: "1GiB", want: GiB},
+		{in: "1G", want: GiB},
+		{in: "1GB", want: GB},
+		{in: "1T", want: TiB},
+		{in: "1TB", want: TB},
+		{in: " 2 MiB ", want: 2 * MiB},
+		{in: "1.5G", want: 1536 * MiB},
+		{in: "0.5K", want: 512},
+		{in: "1.5KB", want: 1500},
+		{in: "8388607T", want: 8388607 * TiB},
+		{in: "", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1X", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "1.1B", wantErr: true},
+		{in: "0.3K", wantErr: true},
+		{in: "8388608T", wantErr: true},
+		{in: "99999999999999999999", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSize(%q) = %d, want error", tt.in, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseSize(%q) returned error: %s", tt.in, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{in: 0, want: "0B"},
+		{in: 1, want: "1B"},
+		{in: 1500, want: "1500B"},
+		{in: KiB, want: "1KiB"},
+		{in: 1000, want: "1KB"},
+		{in: 2 * MB, want: "2MB"},
+		{in: 512 * MiB, want: "512MiB"},
+		{in: 1536 * MiB, want: "1536MiB"},
+		{in: GiB, want: "1GiB"},
+		{in: GB, want: "1GB"},
+		{in: 3 * TiB, want: "3TiB"},
+		{in: 2 * TB, want: "2TB"},
+	}
+
+	for _, tt := range tests {
+		got := FormatSize(tt.in)
+		if got != tt.want {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+
+		parsed, err := ParseSize(got)
+		if err != nil || parsed != tt.in {
+			t.Errorf("ParseSize(FormatSize(%d)) = %d, %v", tt.in, parsed, err)
+		}
+	}
+}
+
+func TestCheckAligned(t *testing.T) {
+	tests := []struct {
+		size    int64
+		align   int64
+		wantErr bool
+	}{
+		{size: GiB, align: 2 * MiB},
+		{size: 0, align: 2 * MiB},
+		{size: GiB + KiB, align: 2 * MiB, wantErr: true},
+		{size: GiB, align: 0, wantErr: true},
+		{size: GiB, align: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := CheckAligned(tt.size, tt.align)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckAligned(%d, %d) = %v, want error %t", tt.size, tt.align, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckHugepageSize(t *testing.T) {
+	tests := []struct {
+		size    int64
+		wantErr bool
+	}{
+		{size: 4 * KiB},
+		{size: DefaultHugepageSize},
+		{size: GiB},
+		{size: 2 * KiB, wantErr: true},
+		{size: 3 * MiB, wantErr: true},
+		{size: 0, wantErr: true},
+		{size: -2 * MiB, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := CheckHugepageSize(tt.size)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckHugepageSize(%d) = %v, want error %t", tt.size, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSizeJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Size
+		wantErr bool
+	}{
+		{in: `1048576`, want: Size(MiB)},
+		{in: `"1M"`, want: Size(MiB)},
+		{in: `"1.5GiB"`, want: Size(1536 * MiB)},
+		{in: `"1KB"`, want: Size(1000)},
+		{in: `"lots"`, wantErr: true},
+		{in: `true`, wantErr: true},
+		{in: `1.5`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var got Size
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unmarshal %s = %d, want error", tt.in, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unmarshal %s returned error: %s", tt.in, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("unmarshal %s = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	data, err := json.Marshal(struct{ Size Size }{Size(512 * MiB)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"Size":"512MiB"}` {
+		t.Errorf("marshal = %s, want %s", data, `{"Size":"512MiB"}`)
+	}
+}